@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+// diff runs the diff command, which reports the differences between two offsets files. It exits
+// with an error if the offsets of any version that was tracked in the old file changed
+func diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flags.String("format", "markdown", "output format: markdown or json")
+	flags.Usage = func() {
+		fmt.Println("usage: go-offsets-tracker diff [-format markdown|json] <old offsets file> <new offsets file>")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 || (*format != "markdown" && *format != "json") {
+		flags.Usage()
+		exit(2)
+	}
+
+	oldTrack, err := offsets.Open(flags.Arg(0))
+	exitOnErr(err, "reading old offsets file")
+	newTrack, err := offsets.Open(flags.Arg(1))
+	exitOnErr(err, "reading new offsets file")
+
+	d := offsets.Diff(oldTrack, newTrack)
+	if *format == "json" {
+		out, err := json.MarshalIndent(d, "", "  ")
+		exitOnErr(err, "encoding diff")
+		_, err = os.Stdout.Write(append(out, '\n'))
+		exitOnErr(err, "writing diff")
+	} else {
+		exitOnErr(d.WriteMarkdown(os.Stdout), "writing diff")
+	}
+	if d.Changed {
+		log.Print("ERROR: the offsets of some versions that were already tracked have changed")
+		exit(1)
+	}
+}
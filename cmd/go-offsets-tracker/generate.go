@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/grafana/go-offsets-tracker/pkg/generator"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+// generateGo runs the generate-go command, which writes a Go package with the offsets of an offsets file
+func generateGo(args []string) {
+	flags := flag.NewFlagSet("generate-go", flag.ExitOnError)
+	pkgName := flags.String("pkg", "offsets", "name of the generated Go package")
+	outFile := flags.String("o", "", "output Go file. If empty, the code is written to the standard output")
+	flags.Usage = func() {
+		fmt.Println("usage: go-offsets-tracker generate-go [-pkg <package>] [-o <output file>] <offsets file>")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(2)
+	}
+
+	track, err := offsets.Open(flags.Arg(0))
+	exitOnErr(err, "reading offsets file")
+	exitOnErr(writeOutput(*outFile, func(w io.Writer) error {
+		return generator.Go(w, track, *pkgName)
+	}), "generating Go code")
+}
+
+// generateC runs the generate-c command, which writes a C header with the offsets of an offsets file,
+// and optionally a Go package with the values of its volatile consts for a given executable
+func generateC(args []string) {
+	flags := flag.NewFlagSet("generate-c", flag.ExitOnError)
+	arch := flags.String("arch", offsets.DefaultArch, "architecture of the offsets, as accepted by GOARCH")
+	outFile := flags.String("o", "", "output C header. If empty, the header is written to the standard output")
+	goFile := flags.String("go", "", "if set, output Go file with the values of the volatile consts of the header")
+	pkgName := flags.String("pkg", "offsets", "name of the Go package of the -go file")
+	flags.Usage = func() {
+		fmt.Println("usage: go-offsets-tracker generate-c [-arch <arch>] [-o <C header>] [-go <Go file> [-pkg <package>]] <offsets file>")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(2)
+	}
+
+	track, err := offsets.Open(flags.Arg(0))
+	exitOnErr(err, "reading offsets file")
+	exitOnErr(writeOutput(*outFile, func(w io.Writer) error {
+		return generator.CHeader(w, track, *arch)
+	}), "generating C header")
+	if *goFile != "" {
+		exitOnErr(writeOutput(*goFile, func(w io.Writer) error {
+			return generator.CConstants(w, track, *arch, *pkgName)
+		}), "generating Go constants")
+	}
+}
+
+// writeOutput writes the output of a command into a file, or into the standard output if the
+// file name is empty. The file is not created if the command fails
+func writeOutput(fileName string, write func(w io.Writer) error) error {
+	if fileName == "" {
+		return write(os.Stdout)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
@@ -6,22 +6,51 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
 
 	"github.com/grafana/go-offsets-tracker/pkg/offsets"
 
 	"github.com/hashicorp/go-version"
 
+	"github.com/grafana/go-offsets-tracker/pkg/downloader"
 	"github.com/grafana/go-offsets-tracker/pkg/target"
 	"github.com/grafana/go-offsets-tracker/pkg/writer"
 )
 
 var (
 	inputFile = flag.String("i", "", "input JSON file with the required offsets definition")
+	bisect    = flag.Bool("bisect", false, "only analyze the versions where the offsets change, bisecting the version list")
+	workers   = flag.Int("j", 1, "maximum number of versions that are downloaded and analyzed concurrently")
+	verify    = flag.Bool("verify", false, "with -bisect, still analyze every version to verify the bisection results")
+	prune     = flag.Bool("prune", false, "remove the structs and fields of the output file that are not in the input file, even if their library failed")
+	keepGoing = flag.Bool("keep-going", false, "continue after a library or version fails, writing the offsets of the rest of versions")
+	maxFails  = flag.Int("max-failures", 0, "with -keep-going, maximum number of failed libraries and versions before exiting with an error")
+	report    = flag.String("report", "", "JSON file where the status of each analyzed library and version is written")
+	resume    = flag.Bool("resume", false, "resume an interrupted run, replaying the versions that were recorded in its journal")
+	table     = flag.String("table", "", "file where the offsets are also written in the binary table format")
 	help      = flag.Bool("h", false, "shows this help")
+
+	toolchainsDir  = flag.String("toolchains", downloader.DefaultToolchainsDir(), "directory where the downloaded Go distributions are cached")
+	toolchainsSize = flag.Int64("toolchains-size", downloader.DefaultToolchainsMaxSize>>20, "maximum size of the cached Go distributions, in MiB")
 )
 
+// commands that are run as "go-offsets-tracker <command> [arguments]", instead of retrieving the offsets
+var commands = map[string]func(args []string){
+	"generate-go": generateGo,
+	"generate-c":  generateC,
+	"diff":        diff,
+	"verify":      verifyExecutables,
+}
+
 func showHelp(isErr bool) {
 	fmt.Println("usage: go-offsets-tracker -i <input file> <output file>")
+	fmt.Println("       go-offsets-tracker generate-go [-pkg <package>] [-o <output file>] <offsets file>")
+	fmt.Println("       go-offsets-tracker generate-c [-arch <arch>] [-o <C header>] [-go <Go file> [-pkg <package>]] <offsets file>")
+	fmt.Println("       go-offsets-tracker diff [-format markdown|json] <old offsets file> <new offsets file>")
+	fmt.Println("       go-offsets-tracker verify [-format text|json] [-all] [-i <input file>] <offsets file> <executable>...")
 	flag.PrintDefaults()
 	if isErr {
 		os.Exit(2)
@@ -30,80 +59,203 @@ func showHelp(isErr bool) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	outFile := flag.Arg(0)
 	if help != nil && *help || outFile == "" || inputFile == nil || *inputFile == "" {
 		showHelp(help == nil || !*help)
 	}
 
-	inputBytes, err := os.ReadFile(*inputFile)
-	exitOnErr(err, "reading input file")
+	ilibs := readInput(*inputFile)
 
-	ilibs := offsets.InputLibs{}
-	exitOnErr(
-		json.Unmarshal(inputBytes, &ilibs),
-		"parsing input file")
+	pool, err := target.NewWorkerPool(*workers)
+	exitOnErr(err, "creating workers")
+	defer pool.Close()
 
-	var libs []*target.Result
-	if std := processGoStdlib(ilibs, outFile); std != nil {
-		libs = append(libs, std)
+	toolchains, err := downloader.NewToolchainCache(*toolchainsDir, *toolchainsSize<<20)
+	exitOnErr(err, "creating toolchains cache")
+
+	// each analyzed version is recorded in the journal, so an interrupted run can be resumed
+	journal, err := target.OpenJournal(outFile+".journal", *resume)
+	exitOnErr(err, "opening journal (run with -resume to continue the interrupted run)")
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-interrupted
+		log.Printf("%s received. Run again with -resume to continue from the last analyzed version", sig)
+		journal.Close()
+		exit(130)
+	}()
+
+	// the Go standard library goes first, then the rest of libraries sorted by name
+	names := make([]string, 0, len(ilibs))
+	for k := range ilibs {
+		if k != offsets.GoStdLib {
+			names = append(names, k)
+		}
 	}
+	sort.Strings(names)
+	names = append([]string{offsets.GoStdLib}, names...)
 
-	for k, v := range ilibs {
-		if k == offsets.GoStdLib {
-			continue
+	// all the libraries are processed concurrently, but the
+	// number of concurrent downloads is limited by the workers pool.
+	// The errors are handled once all the libraries finish
+	results := make([]*target.Result, len(names))
+	errs := make([]error, len(names))
+	wg := sync.WaitGroup{}
+	wg.Add(len(names))
+	for i, name := range names {
+		go func(i int, name string) {
+			defer wg.Done()
+			if name == offsets.GoStdLib {
+				results[i], errs[i] = processGoStdlib(ilibs, outFile, pool, toolchains, journal)
+			} else {
+				results[i], errs[i] = processThirdPartyLib(name, ilibs[name], outFile, pool, journal)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	if !*keepGoing {
+		failed := false
+		for i, err := range errs {
+			if err != nil {
+				log.Printf("ERROR: loading %s offsets: %s", names[i], err)
+				failed = true
+			}
+		}
+		if failed {
+			exit(1)
+		}
+	}
+
+	var libs []*target.Result
+	status := target.Report{}
+	for i, r := range results {
+		if errs[i] != nil {
+			log.Printf("WARNING: loading %s offsets: %s", names[i], errs[i])
+		}
+		if r != nil || errs[i] != nil {
+			status.Add(names[i], r, errs[i])
 		}
-		if l := processThirdPartyLib(k, v, outFile); l != nil {
-			libs = append(libs, l)
+		if r != nil {
+			libs = append(libs, r)
 		}
 	}
 
 	log.Println("Done collecting offsets, writing results to file ...")
-	err = writer.WriteResults(outFile, libs...)
+	writeMode := writer.MergeMode
+	if *prune {
+		writeMode = writer.PruneMode
+	}
+	err = writer.WriteResults(outFile, writeMode, ilibs, libs...)
 	if err != nil {
 		log.Fatalf("error while writing results to file: %v\n", err)
 	}
+	if *table != "" {
+		track, err := offsets.Open(outFile)
+		exitOnErr(err, "reading results file")
+		exitOnErr(writer.WriteTable(*table, track), "writing offsets table")
+	}
+	if err := journal.Remove(); err != nil {
+		log.Printf("WARNING: can't remove the journal: %v", err)
+	}
+
+	if *report != "" {
+		reportBytes, err := json.MarshalIndent(&status, "", "  ")
+		exitOnErr(err, "encoding status report")
+		exitOnErr(os.WriteFile(*report, reportBytes, 0o644), "writing status report")
+	}
+	if status.Failures > *maxFails {
+		log.Printf("ERROR: %d libraries and versions failed, exceeding the maximum of %d", status.Failures, *maxFails)
+		exit(1)
+	}
 
 	log.Println("Done!")
 }
 
-func processGoStdlib(input offsets.InputLibs, outFileName string) *target.Result {
+// readInput reads and validates the input file
+func readInput(file string) offsets.InputLibs {
+	inputBytes, err := os.ReadFile(file)
+	exitOnErr(err, "reading input file")
+
+	ilibs := offsets.InputLibs{}
+	exitOnErr(
+		json.Unmarshal(inputBytes, &ilibs),
+		"parsing input file")
+	exitOnErr(ilibs.Validate(), "validating input file")
+	return ilibs
+}
+
+func processGoStdlib(input offsets.InputLibs, outFileName string, pool *target.WorkerPool, toolchains *downloader.ToolchainCache, journal *target.Journal) (*target.Result, error) {
 	goLib, ok := input[offsets.GoStdLib]
 	if !ok {
-		return nil
+		return nil, nil
 	}
 	minimunGoVersion, err := version.NewConstraint(goLib.Versions)
-	exitOnErr(err, "invalid Go version constraint")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Go version constraint: %w", err)
+	}
 
-	stdLibOffsets, err := target.New("go", outFileName).
+	return target.New("go", outFileName).
 		FindVersionsBy(target.GoDevFileVersionsStrategy).
 		DownloadBinaryBy(target.DownloadPreCompiledBinaryFetchStrategy).
+		Toolchains(toolchains).
 		VersionConstraint(&minimunGoVersion).
+		Architectures(goLib.Architectures).
+		AnalyzeBy(analysisStrategy()).
+		Verify(*verify).
+		KeepGoing(*keepGoing).
+		Journal(journal).
+		Workers(pool).
 		FindOffsets(goLib)
-	exitOnErr(err, "loading Go standard library offsets")
-	return stdLibOffsets
 }
 
-func processThirdPartyLib(name string, lib offsets.LibQuery, outFileName string) *target.Result {
+func processThirdPartyLib(name string, lib offsets.LibQuery, outFileName string, pool *target.WorkerPool, journal *target.Journal) (*target.Result, error) {
 	tData := target.New(name, outFileName)
-	tData = tData.Packages(lib.Packages)
+	tData = tData.Packages(lib.Packages).
+		FindVersionsBy(target.ModuleProxyVersionsStrategy).
+		Architectures(lib.Architectures).
+		AnalyzeBy(analysisStrategy()).
+		Verify(*verify).
+		KeepGoing(*keepGoing).
+		Journal(journal).
+		Workers(pool)
 
 	if lib.Branch != "" {
 		tData = tData.Branch(lib.Branch)
 	} else if lib.Versions != "" {
 		minVersion, err := version.NewConstraint(lib.Versions)
-		exitOnErr(err, "invalid Lib version constraint")
+		if err != nil {
+			return nil, fmt.Errorf("invalid Lib version constraint: %w", err)
+		}
 		tData = tData.VersionConstraint(&minVersion)
 	}
 
-	libOffsets, err := tData.FindOffsets(lib)
-	exitOnErr(err, "loading "+name+" offsets")
-	return libOffsets
+	return tData.FindOffsets(lib)
+}
+
+func analysisStrategy() target.AnalysisStrategy {
+	if *bisect {
+		return target.BisectAnalysisStrategy
+	}
+	return target.LinearAnalysisStrategy
 }
 
 func exitOnErr(err error, str string) {
 	if err != nil {
 		log.Printf("ERROR: %s: %s", str, err.Error())
-		os.Exit(1)
+		exit(1)
 	}
 }
+
+// exit removes the temporary directories before exiting, as the deferred functions are not run
+func exit(code int) {
+	downloader.RemoveTempDirs()
+	os.Exit(code)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+	verifier "github.com/grafana/go-offsets-tracker/pkg/verify"
+)
+
+// verifyExecutables runs the verify command, which checks the offsets of an offsets file against the
+// offsets of local executables. It exits with an error if any tracked offset is wrong or out of date
+func verifyExecutables(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text or json")
+	all := flags.Bool("all", false, "in text format, also print the fields that are verified successfully")
+	input := flags.String("i", "", "input JSON file whose aliases are used to read the renamed structs and fields")
+	flags.Usage = func() {
+		fmt.Println("usage: go-offsets-tracker verify [-format text|json] [-all] [-i <input file>] <offsets file> <executable>...")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() < 2 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		exit(2)
+	}
+
+	track, err := offsets.Open(flags.Arg(0))
+	exitOnErr(err, "reading offsets file")
+	var aliases map[string][]offsets.Alias
+	if *input != "" {
+		aliases = readInput(*input).Aliases()
+	}
+	var reports []*verifier.Report
+	failures := 0
+	for _, exe := range flags.Args()[1:] {
+		report, err := verifier.Executable(track, exe, aliases)
+		exitOnErr(err, "verifying "+exe)
+		reports = append(reports, report)
+		failures += report.Failures
+	}
+
+	if *format == "json" {
+		out, err := json.MarshalIndent(reports, "", "  ")
+		exitOnErr(err, "encoding verification reports")
+		_, err = os.Stdout.Write(append(out, '\n'))
+		exitOnErr(err, "writing verification reports")
+	} else {
+		for _, report := range reports {
+			printReport(report, *all)
+		}
+	}
+	if failures > 0 {
+		log.Printf("ERROR: %d tracked fields are wrong or out of date", failures)
+		exit(1)
+	}
+}
+
+func printReport(report *verifier.Report, all bool) {
+	fmt.Printf("%s (go %s, %s): %d fields, %d failed\n", report.Executable, report.GoVersion, report.Arch,
+		len(report.Fields), report.Failures)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, fr := range report.Fields {
+		if !all && !fr.Status.Failed() {
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s@%s\t%s\ttracked: %s\tfound: %s\t%s\n", fr.Struct, fr.Field, fr.Module, fr.Version,
+			fr.Status, optionalOffset(fr.Tracked), optionalOffset(fr.Found), fr.Error)
+	}
+	_ = tw.Flush()
+}
+
+func optionalOffset(off *uint64) string {
+	if off == nil {
+		return "-"
+	}
+	return fmt.Sprint(*off)
+}
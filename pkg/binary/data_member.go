@@ -2,51 +2,146 @@ package binary
 
 import (
 	"debug/dwarf"
-	"io"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
-func findDataMemberOffset(dwarfData *dwarf.Data, dm *DataMember) (int64, bool) {
-	reader := dwarfData.Reader()
-	for {
-		entry, err := reader.Next()
-		if err == io.EOF || entry == nil {
-			break
-		}
-
-		if entry.Tag == dwarf.TagStructType {
-			// Go through fields
-			for _, field := range entry.Field {
-				if field.Attr == dwarf.AttrName {
-					str := field.Val.(string)
-					if str == dm.StructName {
-						return findFieldOffset(reader, dm.Field)
-					}
-				}
-			}
+// ErrStructNotFound is returned when the analyzed binary does not contain the requested struct
+type ErrStructNotFound struct {
+	Struct string
+}
+
+func (e *ErrStructNotFound) Error() string {
+	return "struct " + e.Struct + " not found"
+}
+
+// ErrFieldNotFound is returned when the analyzed binary contains the requested
+// struct, but the struct does not contain the requested field
+type ErrFieldNotFound struct {
+	Struct string
+	Field  string
+}
+
+func (e *ErrFieldNotFound) Error() string {
+	return "field " + e.Field + " not found in struct " + e.Struct
+}
+
+// structEntry is a struct type of the DWARF data, with its members
+type structEntry struct {
+	entry   *dwarf.Entry
+	members []*dwarf.Entry
+}
+
+// member returns the entry of a member of the struct
+func (s *structEntry) member(field string) (*dwarf.Entry, bool) {
+	for _, m := range s.members {
+		if entryName(m) == field {
+			return m, true
 		}
 	}
+	return nil, false
+}
 
-	return 0, false
+// layout returns a description of the size of a struct and the name and offset of each member
+func (s *structEntry) layout() string {
+	layout := strings.Builder{}
+	layout.WriteString(strconv.FormatUint(byteSize(s.entry), 10))
+	for _, m := range s.members {
+		offset, _ := findOffsetByEntry(m)
+		layout.WriteString("," + entryName(m) + "@" + strconv.FormatInt(offset, 10))
+	}
+	return layout.String()
+}
+
+// dwarfIndex contains the struct types of the DWARF data and their members, which are read in
+// a single pass, so many fields can be looked up without scanning the DWARF data for each of them
+type dwarfIndex struct {
+	data     *dwarf.Data
+	byOffset map[dwarf.Offset]*structEntry
+	// byName contains all the definitions of each named struct. Many compilation
+	// units might define a struct with the same name (e.g. C structs)
+	byName map[string][]*structEntry
 }
 
-func findFieldOffset(reader *dwarf.Reader, field string) (int64, bool) {
+func newDWARFIndex(dwarfData *dwarf.Data) (*dwarfIndex, error) {
+	idx := &dwarfIndex{
+		data:     dwarfData,
+		byOffset: map[dwarf.Offset]*structEntry{},
+		byName:   map[string][]*structEntry{},
+	}
+	reader := dwarfData.Reader()
+	// strct is the struct whose members are being read
+	var strct *structEntry
 	for {
 		entry, err := reader.Next()
-		if err == io.EOF || entry == nil {
-			break
+		if err != nil {
+			return nil, fmt.Errorf("reading DWARF data: %w", err)
 		}
-
-		for _, f := range entry.Field {
-			if f.Attr == dwarf.AttrName {
-				str := f.Val.(string)
-				if str == field {
-					return findOffsetByEntry(entry)
-				}
+		if entry == nil {
+			return idx, nil
+		}
+		if strct != nil {
+			switch {
+			case entry.Tag == 0:
+				// the children of the struct end with a null entry
+				strct = nil
+			case entry.Tag == dwarf.TagMember:
+				strct.members = append(strct.members, entry)
+			}
+			if entry.Children {
+				reader.SkipChildren()
 			}
+			continue
+		}
+		if entry.Tag != dwarf.TagStructType {
+			continue
+		}
+		// skip forward declarations, which do not define the struct members
+		if decl, _ := entry.Val(dwarf.AttrDeclaration).(bool); decl {
+			if entry.Children {
+				reader.SkipChildren()
+			}
+			continue
+		}
+		s := &structEntry{entry: entry}
+		idx.byOffset[entry.Offset] = s
+		if name := entryName(entry); name != "" {
+			idx.byName[name] = append(idx.byName[name], s)
+		}
+		if entry.Children {
+			strct = s
 		}
 	}
+}
 
-	return 0, false
+// findDataMember returns the entries of the struct and the member of the provided data member
+func (idx *dwarfIndex) findDataMember(dm *DataMember) (*structEntry, *dwarf.Entry, error) {
+	strct, err := idx.findStruct(dm.StructName)
+	if err != nil {
+		return nil, nil, err
+	}
+	member, ok := strct.member(dm.Field)
+	if !ok {
+		return nil, nil, &ErrFieldNotFound{Struct: dm.StructName, Field: dm.Field}
+	}
+	return strct, member, nil
+}
+
+// findStruct returns the definition of a struct. If many compilation units define the
+// struct, it verifies that all the definitions have the same layout.
+func (idx *dwarfIndex) findStruct(structName string) (*structEntry, error) {
+	defs := idx.byName[structName]
+	if len(defs) == 0 {
+		return nil, &ErrStructNotFound{Struct: structName}
+	}
+	for _, def := range defs[1:] {
+		if def.layout() != defs[0].layout() {
+			return nil, fmt.Errorf("struct %s is defined with different layouts at offsets 0x%x and 0x%x",
+				structName, defs[0].entry.Offset, def.entry.Offset)
+		}
+	}
+	return defs[0], nil
 }
 
 func findOffsetByEntry(entry *dwarf.Entry) (int64, bool) {
@@ -58,3 +153,37 @@ func findOffsetByEntry(entry *dwarf.Entry) (int64, bool) {
 
 	return 0, false
 }
+
+// typeNameAndSize returns the name and the byte size of the type of a member entry
+func typeNameAndSize(dwarfData *dwarf.Data, member *dwarf.Entry) (string, uint64, error) {
+	off, ok := member.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return "", 0, fmt.Errorf("%s does not have any type", entryName(member))
+	}
+	reader := dwarfData.Reader()
+	reader.Seek(off)
+	typ, err := reader.Next()
+	if err != nil {
+		return "", 0, err
+	}
+	if typ == nil {
+		return "", 0, fmt.Errorf("type of %s not found", entryName(member))
+	}
+	name := entryName(typ)
+	// typedefs do not have size, so we get it from the type they define
+	for typ.Tag == dwarf.TagTypedef {
+		if typ, err = typeEntry(dwarfData, typ); err != nil {
+			return "", 0, err
+		}
+	}
+	if typ.Tag == dwarf.TagPointerType {
+		// Go does not annotate the size of pointer types (which includes maps and channels)
+		return name, uint64(reader.AddressSize()), nil
+	}
+	return name, byteSize(typ), nil
+}
+
+func byteSize(entry *dwarf.Entry) uint64 {
+	size, _ := entry.Val(dwarf.AttrByteSize).(int64)
+	return uint64(size)
+}
@@ -0,0 +1,149 @@
+package binary
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"strings"
+)
+
+const derefSeparator = "->"
+
+// Hop is each of the steps to reach a field that is specified as a path
+// (e.g. URL->Path or Stream.ctx) from the start of its root struct
+type Hop struct {
+	// Field name
+	Field string
+	// Offset of the field from the start of the struct that contains it
+	Offset uint64
+	// Deref is true if the field is a pointer that needs to be dereferenced
+	// to reach the next hop
+	Deref bool
+}
+
+// IsFieldPath returns whether the field name is a path that goes through other
+// struct fields. Fields are separated by "." when the next field is part of the
+// struct value (e.g. an embedded struct) and by "->" when the next field is accessed
+// through a pointer.
+func IsFieldPath(field string) bool {
+	return strings.Contains(field, ".") || strings.Contains(field, derefSeparator)
+}
+
+// parseFieldPath splits a field path in hops, without their offsets
+func parseFieldPath(path string) ([]Hop, error) {
+	var hops []Hop
+	for _, part := range strings.Split(path, derefSeparator) {
+		names := strings.Split(part, ".")
+		for _, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+			hops = append(hops, Hop{Field: name})
+		}
+		hops[len(hops)-1].Deref = true
+	}
+	// the last field does not need to be dereferenced
+	hops[len(hops)-1].Deref = false
+	return hops, nil
+}
+
+// PathOffset returns the offset of the last field in the path, relative to the start of the
+// struct value that is accessed after the last pointer dereference. If the path does not
+// dereference any pointer, it is the offset from the start of the root struct.
+func PathOffset(hops []Hop) uint64 {
+	var offset uint64
+	for _, h := range hops {
+		offset += h.Offset
+		if h.Deref {
+			offset = 0
+		}
+	}
+	return offset
+}
+
+// findFieldPathOffsets returns the hops of a field path, starting at the given struct,
+// as well as the root struct and the member entry at the end of the path
+func (idx *dwarfIndex) findFieldPathOffsets(structName, path string) ([]Hop, *structEntry, *dwarf.Entry, error) {
+	hops, err := parseFieldPath(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	root, err := idx.findStruct(structName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	strct := root
+	var member *dwarf.Entry
+	for i := range hops {
+		var ok bool
+		member, ok = strct.member(hops[i].Field)
+		if !ok {
+			return nil, nil, nil, &ErrFieldNotFound{Struct: entryName(strct.entry), Field: hops[i].Field}
+		}
+		offset, ok := findOffsetByEntry(member)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("field %s in %s does not have any offset", hops[i].Field, entryName(strct.entry))
+		}
+		hops[i].Offset = uint64(offset)
+		if i == len(hops)-1 {
+			break
+		}
+		next, err := memberStruct(idx.data, member, hops[i].Deref)
+		if err == nil && idx.byOffset[next.Offset] == nil {
+			err = fmt.Errorf("type %s not found", entryName(next))
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s in %s: %w", hops[i].Field, entryName(strct.entry), err)
+		}
+		strct = idx.byOffset[next.Offset]
+	}
+	return hops, root, member, nil
+}
+
+// memberStruct returns the struct entry of the type of a member. If deref is true,
+// the member type must be a pointer to a struct.
+func memberStruct(dwarfData *dwarf.Data, member *dwarf.Entry, deref bool) (*dwarf.Entry, error) {
+	typ, err := typeEntry(dwarfData, member)
+	if err != nil {
+		return nil, err
+	}
+	if deref {
+		if typ.Tag != dwarf.TagPointerType {
+			return nil, fmt.Errorf("type %s is not a pointer", entryName(typ))
+		}
+		if typ, err = typeEntry(dwarfData, typ); err != nil {
+			return nil, err
+		}
+	}
+	if typ.Tag != dwarf.TagStructType {
+		return nil, fmt.Errorf("type %s is not a struct", entryName(typ))
+	}
+	return typ, nil
+}
+
+// typeEntry returns the entry of the type referenced by the provided entry, skipping typedefs
+func typeEntry(dwarfData *dwarf.Data, entry *dwarf.Entry) (*dwarf.Entry, error) {
+	for {
+		off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			return nil, fmt.Errorf("%s does not have any type", entryName(entry))
+		}
+		reader := dwarfData.Reader()
+		reader.Seek(off)
+		typ, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if typ == nil {
+			return nil, fmt.Errorf("type of %s not found", entryName(entry))
+		}
+		if typ.Tag != dwarf.TagTypedef {
+			return typ, nil
+		}
+		entry = typ
+	}
+}
+
+func entryName(entry *dwarf.Entry) string {
+	name, _ := entry.Val(dwarf.AttrName).(string)
+	return name
+}
@@ -0,0 +1,75 @@
+package binary
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		hops []Hop
+	}{
+		{path: "a", hops: []Hop{{Field: "a"}}},
+		{path: "a.b", hops: []Hop{{Field: "a"}, {Field: "b"}}},
+		{path: "a->b", hops: []Hop{{Field: "a", Deref: true}, {Field: "b"}}},
+		{path: "a->b.c", hops: []Hop{{Field: "a", Deref: true}, {Field: "b"}, {Field: "c"}}},
+		{path: "a.b->c->d", hops: []Hop{{Field: "a"}, {Field: "b", Deref: true}, {Field: "c", Deref: true}, {Field: "d"}}},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			hops, err := parseFieldPath(tc.path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.hops, hops)
+		})
+	}
+	for _, path := range []string{"", "a..b", "->a", "a->", ".a", "a.", "a->->b", "a.->b"} {
+		t.Run("invalid "+path, func(t *testing.T) {
+			_, err := parseFieldPath(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPathOffset(t *testing.T) {
+	// without dereferences, the offsets are accumulated from the root struct
+	assert.EqualValues(t, 24, PathOffset([]Hop{{Field: "a", Offset: 16}, {Field: "b", Offset: 8}}))
+	// after a dereference, the offset is relative to the pointed struct
+	assert.EqualValues(t, 12, PathOffset([]Hop{
+		{Field: "a", Offset: 16}, {Field: "b", Offset: 8, Deref: true}, {Field: "c", Offset: 4}, {Field: "d", Offset: 8},
+	}))
+	assert.EqualValues(t, 0, PathOffset(nil))
+}
+
+func TestFindOffsets_DerefNonPointer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	dir := t.TempDir()
+	withDWARF := filepath.Join(dir, "prog")
+	stripped := filepath.Join(dir, "prog-stripped")
+	buildProgram(t, withDWARF)
+	buildProgram(t, stripped, "-ldflags=-s -w")
+
+	for _, path := range []string{withDWARF, stripped} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+
+			// the embedded inner struct is a value, so it can't be dereferenced
+			_, err = FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.outer", Field: "inner->Name"}})
+			require.Error(t, err)
+			var fnf *ErrFieldNotFound
+			assert.False(t, errors.As(err, &fnf))
+			// but it can be accessed as a value
+			res, err := FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.outer", Field: "inner.Name"}})
+			require.NoError(t, err)
+			assert.EqualValues(t, 16, res.DataMembers[0].Offset)
+		})
+	}
+}
@@ -1,22 +1,101 @@
 package binary
 
 import (
+	"debug/buildinfo"
+	"debug/dwarf"
 	"debug/elf"
+	"errors"
+	"fmt"
 	"os"
 
-	"golang.org/x/mod/semver"
+	"github.com/hashicorp/go-version"
 )
 
 type DataMember struct {
 	StructName string
 	Field      string
-	MinVersion string
-	MaxVersion string
+	// Versions constraint where the data member is looked up. If empty, it is looked up in all the versions
+	Versions version.Constraints
+	// Optional data members are reported as Absent if their struct or field is not found
+	Optional bool
+	// Aliases are the names of the struct and the field in the analyzed binaries, for the
+	// versions where they differ from StructName and Field (e.g. after a rename)
+	Aliases []Alias
+}
+
+// Alias is the physical name of the struct and the field of a DataMember, for the versions
+// that match the constraints
+type Alias struct {
+	Versions version.Constraints
+	// StructName in the analyzed binaries. If empty, it is the same as the DataMember
+	StructName string
+	// Field name in the analyzed binaries. If empty, it is the same as the DataMember
+	Field string
+}
+
+// physical returns the data member whose struct and field names have to be looked up in the
+// binary of the provided version. It returns the data member itself if no alias applies
+func (dm *DataMember) physical(ver string) *DataMember {
+	if len(dm.Aliases) == 0 {
+		return dm
+	}
+	// versions that can't be parsed (e.g. branch names) do not match any alias
+	v, err := version.NewVersion(ver)
+	if err != nil {
+		return dm
+	}
+	for _, alias := range dm.Aliases {
+		if !alias.Versions.Check(v) {
+			continue
+		}
+		p := *dm
+		p.Aliases = nil
+		if alias.StructName != "" {
+			p.StructName = alias.StructName
+		}
+		if alias.Field != "" {
+			p.Field = alias.Field
+		}
+		return &p
+	}
+	return dm
 }
 
 type DataMemberOffset struct {
 	*DataMember
+	// Offset of the field. If the field is a path, it is the offset from
+	// the last dereferenced pointer, as returned by PathOffset
 	Offset uint64
+	// Hops to reach the field, if the field is a path. Otherwise it is nil
+	Hops []Hop
+	// Size in bytes of the field
+	Size uint64
+	// StructSize is the size in bytes of the struct
+	StructSize uint64
+	// Type name of the field
+	Type string
+	// Module that owns the struct and its version in the analyzed binary, if the struct belongs to
+	// a dependency of the analyzed library. Otherwise, both are empty
+	Module        string
+	ModuleVersion string
+	// Absent is true if the data member is optional, and it does not exist in the analyzed binary.
+	// Then, the rest of fields are not set
+	Absent bool
+}
+
+// Equal returns whether both data members are found at the same location,
+// with the same type and the same struct and field sizes
+func (dmo *DataMemberOffset) Equal(o *DataMemberOffset) bool {
+	if dmo.Absent != o.Absent || dmo.Offset != o.Offset || dmo.Size != o.Size || dmo.StructSize != o.StructSize ||
+		dmo.Type != o.Type || len(dmo.Hops) != len(o.Hops) {
+		return false
+	}
+	for i := range dmo.Hops {
+		if dmo.Hops[i] != o.Hops[i] {
+			return false
+		}
+	}
+	return true
 }
 
 type Result struct {
@@ -25,45 +104,197 @@ type Result struct {
 
 type ErrOffsetsNotFound struct {
 	fieldName string
+	cause     error
 }
 
 func (e *ErrOffsetsNotFound) Error() string {
+	if e.cause != nil {
+		return "could not find offsets for " + e.fieldName + ": " + e.cause.Error()
+	}
 	return "could not find offsets for " + e.fieldName
 }
 
-func FindOffsets(version string, file *os.File, dataMembers []*DataMember) (*Result, error) {
-	elfF, err := elf.NewFile(file)
+// Unwrap returns the cause of the error, such as an ErrStructNotFound or an ErrFieldNotFound
+func (e *ErrOffsetsNotFound) Unwrap() error {
+	return e.cause
+}
+
+// File is a Go executable whose struct types are indexed, so the offsets of many fields can
+// be looked up without parsing it again. A File can be shared by many callers, concurrently.
+type File struct {
+	file *os.File
+	elf  *elf.File
+	// the struct types are indexed from the DWARF data, if available.
+	// Otherwise, from the runtime type descriptors
+	dwarf   *dwarfIndex
+	runtime *runtimeTypes
+}
+
+// Open an executable and index its struct types. The File must be closed after its usage
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newFile(file)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
+	return f, nil
+}
 
+func newFile(file *os.File) (*File, error) {
+	elfF, err := elf.NewFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{file: file, elf: elfF}
 	dwarfData, err := elfF.DWARF()
+	if err != nil {
+		// stripped executables do not contain DWARF data, but their
+		// runtime type descriptors still provide the struct layouts
+		var rtErr error
+		if f.runtime, rtErr = newRuntimeTypes(elfF, file); rtErr != nil {
+			return nil, fmt.Errorf("%w. Runtime type descriptors can't be used: %v", err, rtErr)
+		}
+		return f, nil
+	}
+	if f.dwarf, err = newDWARFIndex(dwarfData); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close the executable file
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// BuildInfo returns the build information that is embedded into the executable
+func (f *File) BuildInfo() (*buildinfo.BuildInfo, error) {
+	return buildinfo.Read(f.file)
+}
+
+// FindOffsets returns the offsets of the data members that apply to the provided version
+func (f *File) FindOffsets(version string, dataMembers []*DataMember) (*Result, error) {
+	if f.runtime != nil {
+		return findRuntimeOffsets(version, f.runtime, dataMembers)
+	}
+	return findDWARFOffsets(version, f.dwarf, dataMembers)
+}
+
+// FindOffsets returns the offsets of the data members that apply to the provided version. To look
+// up the offsets of the same executable many times, use Open instead, which only indexes it once.
+func FindOffsets(version string, file *os.File, dataMembers []*DataMember) (*Result, error) {
+	f, err := newFile(file)
 	if err != nil {
 		return nil, err
 	}
+	return f.FindOffsets(version, dataMembers)
+}
 
+func findDWARFOffsets(version string, idx *dwarfIndex, dataMembers []*DataMember) (*Result, error) {
 	result := &Result{}
 	for _, dm := range dataMembers {
-		if dm.MinVersion != "" {
-			if semver.Compare(version, "v"+dm.MinVersion) < 0 {
+		if !dm.AppliesTo(version) {
+			continue
+		}
+
+		// the offsets are reported for the logical data member, but looked up by its physical name
+		lookup := dm.physical(version)
+		var dmo *DataMemberOffset
+		var strct *structEntry
+		var member *dwarf.Entry
+		if IsFieldPath(lookup.Field) {
+			hops, root, last, err := idx.findFieldPathOffsets(lookup.StructName, lookup.Field)
+			if isAbsent(dm, err) {
+				result.DataMembers = append(result.DataMembers, &DataMemberOffset{DataMember: dm, Absent: true})
 				continue
 			}
-		} else if dm.MaxVersion != "" {
-			if semver.Compare(version, "v"+dm.MaxVersion) > 0 {
-				continue
+			if err != nil {
+				return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field, cause: err}
 			}
-		}
-
-		offset, found := findDataMemberOffset(dwarfData, dm)
-		if !found {
-			return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field}
+			dmo = &DataMemberOffset{
+				DataMember: dm,
+				Offset:     PathOffset(hops),
+				Hops:       hops,
+			}
+			strct, member = root, last
 		} else {
-			result.DataMembers = append(result.DataMembers, &DataMemberOffset{
+			var err error
+			strct, member, err = idx.findDataMember(lookup)
+			if isAbsent(dm, err) {
+				result.DataMembers = append(result.DataMembers, &DataMemberOffset{DataMember: dm, Absent: true})
+				continue
+			}
+			if err != nil {
+				return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field, cause: err}
+			}
+			offset, found := findOffsetByEntry(member)
+			if !found {
+				return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field,
+					cause: fmt.Errorf("field %s in %s does not have any offset", lookup.Field, lookup.StructName)}
+			}
+			dmo = &DataMemberOffset{
 				DataMember: dm,
 				Offset:     uint64(offset),
-			})
+			}
 		}
+
+		dmo.StructSize = byteSize(strct.entry)
+		var err error
+		if dmo.Type, dmo.Size, err = typeNameAndSize(idx.data, member); err != nil {
+			return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field, cause: err}
+		}
+		result.DataMembers = append(result.DataMembers, dmo)
 	}
 
 	return result, nil
 }
+
+func findRuntimeOffsets(version string, rt *runtimeTypes, dataMembers []*DataMember) (*Result, error) {
+	result := &Result{}
+	for _, dm := range dataMembers {
+		if !dm.AppliesTo(version) {
+			continue
+		}
+		dmo, err := rt.findOffsets(dm.physical(version))
+		if err == nil {
+			// the offsets are reported for the logical data member
+			dmo.DataMember = dm
+		}
+		if isAbsent(dm, err) {
+			dmo, err = &DataMemberOffset{DataMember: dm, Absent: true}, nil
+		}
+		if err != nil {
+			return nil, &ErrOffsetsNotFound{fieldName: dm.StructName + " " + dm.Field, cause: err}
+		}
+		result.DataMembers = append(result.DataMembers, dmo)
+	}
+	return result, nil
+}
+
+// isAbsent returns true if the data member is optional and the
+// error is caused because its struct or its field are not found
+func isAbsent(dm *DataMember, err error) bool {
+	if !dm.Optional || err == nil {
+		return false
+	}
+	var snf *ErrStructNotFound
+	var fnf *ErrFieldNotFound
+	return errors.As(err, &snf) || errors.As(err, &fnf)
+}
+
+// AppliesTo returns whether the data member needs to be looked up in the provided version
+func (dm *DataMember) AppliesTo(ver string) bool {
+	if len(dm.Versions) == 0 {
+		return true
+	}
+	// versions that can't be parsed (e.g. branch names) are not constrained
+	v, err := version.NewVersion(ver)
+	if err != nil {
+		return true
+	}
+	return dm.Versions.Check(v)
+}
@@ -0,0 +1,186 @@
+package binary
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOffsets_NotFound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	dir := t.TempDir()
+	withDWARF := filepath.Join(dir, "prog")
+	stripped := filepath.Join(dir, "prog-stripped")
+	buildProgram(t, withDWARF)
+	buildProgram(t, stripped, "-ldflags=-s -w")
+
+	for _, path := range []string{withDWARF, stripped} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+
+			// ID is a field of the embedded inner struct, which is not looked up
+			_, err = FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.outer", Field: "ID"}})
+			var nf *ErrOffsetsNotFound
+			assert.ErrorAs(t, err, &nf)
+			var fnf *ErrFieldNotFound
+			require.ErrorAs(t, err, &fnf)
+			assert.Equal(t, ErrFieldNotFound{Struct: "main.outer", Field: "ID"}, *fnf)
+
+			_, err = FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.outer", Field: "Ref->Unknown"}})
+			require.ErrorAs(t, err, &fnf)
+			assert.Equal(t, ErrFieldNotFound{Struct: "main.inner", Field: "Unknown"}, *fnf)
+
+			_, err = FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.unknown", Field: "ID"}})
+			var snf *ErrStructNotFound
+			require.ErrorAs(t, err, &snf)
+			assert.Equal(t, "main.unknown", snf.Struct)
+			assert.False(t, errors.As(err, &fnf))
+
+			// optional data members are reported as absent, instead of failing
+			res, err := FindOffsets("v1.0.0", f, []*DataMember{
+				{StructName: "main.outer", Field: "ID", Optional: true},
+				{StructName: "main.unknown", Field: "ID", Optional: true},
+				{StructName: "main.outer", Field: "Ref->Name", Optional: true},
+			})
+			require.NoError(t, err)
+			require.Len(t, res.DataMembers, 3)
+			assert.True(t, res.DataMembers[0].Absent)
+			assert.True(t, res.DataMembers[1].Absent)
+			assert.False(t, res.DataMembers[2].Absent)
+			assert.NotEmpty(t, res.DataMembers[2].Type)
+		})
+	}
+}
+
+func TestOpen_Concurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	dir := t.TempDir()
+	withDWARF := filepath.Join(dir, "prog")
+	stripped := filepath.Join(dir, "prog-stripped")
+	buildProgram(t, withDWARF)
+	buildProgram(t, stripped, "-ldflags=-s -w")
+	dms := []*DataMember{
+		{StructName: "main.outer", Field: "Ref->Name"},
+		{StructName: "net/url.URL", Field: "User"},
+	}
+
+	for _, path := range []string{withDWARF, stripped} {
+		f, err := Open(path)
+		require.NoError(t, err)
+		bi, err := f.BuildInfo()
+		require.NoError(t, err)
+		assert.Equal(t, "github.com/grafana/go-offsets-tracker/pkg/binary/testdata/runtimetypes", bi.Path)
+
+		// the same file is shared by many callers
+		results := make([]*Result, 8)
+		wg := sync.WaitGroup{}
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, err := f.FindOffsets("v1.0.0", dms)
+				assert.NoError(t, err)
+				results[i] = res
+			}(i)
+		}
+		wg.Wait()
+		require.NoError(t, f.Close())
+		for _, res := range results[1:] {
+			require.Len(t, res.DataMembers, len(dms))
+			for i := range dms {
+				assert.True(t, results[0].DataMembers[i].Equal(res.DataMembers[i]))
+			}
+		}
+	}
+}
+
+func TestFindOffsets_Aliases(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	dir := t.TempDir()
+	withDWARF := filepath.Join(dir, "prog")
+	stripped := filepath.Join(dir, "prog-stripped")
+	buildProgram(t, withDWARF)
+	buildProgram(t, stripped, "-ldflags=-s -w")
+	// main.record was renamed to main.outer in v1.0.0, and its Label field moved to Ref->Name
+	dm := &DataMember{StructName: "main.record", Field: "Label", Aliases: []Alias{{
+		Versions:   version.MustConstraints(version.NewConstraint(">= 1.0.0")),
+		StructName: "main.outer",
+		Field:      "Ref->Name",
+	}}}
+
+	for _, path := range []string{withDWARF, stripped} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+
+			res, err := f.FindOffsets("v1.2.0", []*DataMember{dm})
+			require.NoError(t, err)
+			require.Len(t, res.DataMembers, 1)
+			// the offsets are reported for the logical name
+			assert.Same(t, dm, res.DataMembers[0].DataMember)
+			assert.EqualValues(t, 8, res.DataMembers[0].Offset)
+			assert.Equal(t, "string", res.DataMembers[0].Type)
+
+			_, err = f.FindOffsets("v0.9.0", []*DataMember{dm})
+			var snf *ErrStructNotFound
+			require.ErrorAs(t, err, &snf)
+			assert.Equal(t, "main.record", snf.Struct)
+		})
+	}
+}
+
+func TestFindOffsets_TypesAndSizes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	withDWARF := filepath.Join(t.TempDir(), "prog")
+	buildProgram(t, withDWARF)
+
+	dms := []*DataMember{
+		{StructName: "main.outer", Field: "Flag"},
+		{StructName: "main.outer", Field: "inner"},
+		{StructName: "main.outer", Field: "Ref"},
+		{StructName: "main.outer", Field: "Tags"},
+		{StructName: "main.outer", Field: "Attrs"},
+		{StructName: "main.outer", Field: "Hash"},
+		{StructName: "main.outer", Field: "Ref->Name"},
+	}
+	res := findOffsetsInFile(t, withDWARF, dms)
+	require.Len(t, res.DataMembers, len(dms))
+	for i, expected := range []struct {
+		typ        string
+		size       uint64
+		structSize uint64
+	}{
+		{typ: "bool", size: 1, structSize: 96},
+		// embedded struct
+		{typ: "main.inner", size: 24, structSize: 96},
+		// pointers have the size of an address
+		{typ: "*main.inner", size: 8, structSize: 96},
+		{typ: "[]string", size: 24, structSize: 96},
+		{typ: "map[string]int", size: 8, structSize: 96},
+		{typ: "[4]uint32", size: 16, structSize: 96},
+		// the struct size is the size of the root struct of the path
+		{typ: "string", size: 16, structSize: 96},
+	} {
+		dmo := res.DataMembers[i]
+		assert.Equalf(t, expected.typ, dmo.Type, "%s type", dmo.Field)
+		assert.Equalf(t, expected.size, dmo.Size, "%s size", dmo.Field)
+		assert.Equalf(t, expected.structSize, dmo.StructSize, "%s struct size", dmo.Field)
+	}
+}
@@ -0,0 +1,527 @@
+package binary
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Kinds and flags of the Go runtime type descriptors (internal/abi/type.go)
+const (
+	kindMask   = 0x1f
+	kindArray  = 17
+	kindChan   = 18
+	kindFunc   = 19
+	kindIface  = 20
+	kindMap    = 21
+	kindPtr    = 22
+	kindSlice  = 23
+	kindStruct = 25
+
+	tflagUncommon  = 1 << 0
+	tflagExtraStar = 1 << 1
+	tflagNamed     = 1 << 2
+
+	maxStructFields = 1 << 16
+)
+
+var goMinorVersion = regexp.MustCompile(`go1\.(\d+)`)
+
+// runtimeTypes extracts the struct layouts from the type descriptors that the Go runtime
+// embeds into the executables for reflection and garbage collection. They are available
+// even if the executable has been stripped from its DWARF data and symbols
+// (e.g. built with -ldflags="-s -w").
+// Type descriptors are located between the types and etypes addresses of the runtime.moduledata
+// structure, which is found from the address of the .gopclntab section.
+// Only non-PIE ELF executables are supported, and their build info must be readable to know
+// the layout of the runtime structures of their Go version.
+type runtimeTypes struct {
+	mem     *memory
+	order   binary.ByteOrder
+	ptrSize uint64
+	// goMinor is the minor version of the Go 1.x compiler
+	goMinor int
+	types   uint64
+	etypes  uint64
+
+	// structs key: qualified struct name, value: address of the type descriptor
+	structs map[string]uint64
+	// packages key: package name, value: package path, or empty if many packages share the name
+	packages map[string]string
+}
+
+// field of a struct type descriptor
+type runtimeField struct {
+	name   string
+	offset uint64
+	typ    uint64
+}
+
+func newRuntimeTypes(elfF *elf.File, exe io.ReaderAt) (*runtimeTypes, error) {
+	bi, err := buildinfo.Read(exe)
+	if err != nil {
+		return nil, fmt.Errorf("reading Go version from build info: %w", err)
+	}
+	match := goMinorVersion.FindStringSubmatch(bi.GoVersion)
+	if match == nil {
+		return nil, fmt.Errorf("unsupported Go version: %s", bi.GoVersion)
+	}
+	rt := &runtimeTypes{
+		mem:     &memory{elfF: elfF, segments: map[*elf.Prog][]byte{}},
+		order:   elfF.ByteOrder,
+		ptrSize: 8,
+	}
+	if elfF.Class == elf.ELFCLASS32 {
+		rt.ptrSize = 4
+	}
+	if rt.goMinor, err = strconv.Atoi(match[1]); err != nil {
+		return nil, fmt.Errorf("unsupported Go version %s: %w", bi.GoVersion, err)
+	}
+	if rt.goMinor < 13 {
+		return nil, fmt.Errorf("unsupported Go version: %s", bi.GoVersion)
+	}
+	if err := rt.findModuleData(); err != nil {
+		return nil, err
+	}
+	rt.indexStructs()
+	return rt, nil
+}
+
+// findModuleData looks for the runtime.firstmoduledata structure (placed in its own .go.module
+// section by the newest Go versions), whose first word
+// points to the start of the .gopclntab section, and reads the boundaries of the type descriptors
+func (rt *runtimeTypes) findModuleData() error {
+	pclntab := rt.mem.elfF.Section(".gopclntab")
+	if pclntab == nil {
+		return errors.New("no .gopclntab section found. Position-independent executables are not supported")
+	}
+	// words index of the types and etypes fields of the moduledata struct
+	typesIdx := uint64(37)
+	switch {
+	case rt.goMinor < 16:
+		typesIdx = 25
+	case rt.goMinor < 20:
+		typesIdx = 35
+	}
+	etypesIdx := typesIdx + 1
+	if rt.goMinor >= 27 {
+		// since Go 1.27, the typedesclen field is between types and etypes
+		etypesIdx++
+	}
+	for _, name := range []string{".go.module", ".noptrdata", ".data"} {
+		sect := rt.mem.elfF.Section(name)
+		if sect == nil {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			return fmt.Errorf("reading %s section: %w", name, err)
+		}
+		for off := uint64(0); off+rt.ptrSize <= uint64(len(data)); off += rt.ptrSize {
+			if rt.word(data[off:]) != pclntab.Addr {
+				continue
+			}
+			moduleData := sect.Addr + off
+			types, err1 := rt.readWord(moduleData + typesIdx*rt.ptrSize)
+			etypes, err2 := rt.readWord(moduleData + etypesIdx*rt.ptrSize)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			if types >= etypes || etypes-types > 1<<31 || !rt.mem.contains(types) {
+				continue
+			}
+			rt.types, rt.etypes = types, etypes
+			return nil
+		}
+	}
+	return errors.New("can't find the Go runtime module data")
+}
+
+// indexStructs scans the type descriptors region looking for named struct types
+func (rt *runtimeTypes) indexStructs() {
+	rt.structs = map[string]uint64{}
+	rt.packages = map[string]string{}
+	for addr := rt.types; addr < rt.etypes; addr += rt.ptrSize {
+		pkgPath, str, ok := rt.namedStruct(addr)
+		if !ok {
+			continue
+		}
+		name := pkgPath + "." + unqualifiedName(str)
+		if _, dup := rt.structs[name]; !dup {
+			rt.structs[name] = addr
+		}
+		pkgName, _, _ := strings.Cut(str, ".")
+		if path, ok := rt.packages[pkgName]; !ok {
+			rt.packages[pkgName] = pkgPath
+		} else if path != pkgPath {
+			rt.packages[pkgName] = ""
+		}
+	}
+}
+
+// namedStruct returns the package path and the type string of the type descriptor at the given
+// address, if it looks like a valid named struct descriptor
+func (rt *runtimeTypes) namedStruct(addr uint64) (pkgPath, str string, ok bool) {
+	hdr := rt.headerSize()
+	raw, err := rt.mem.read(addr, int(hdr+4*rt.ptrSize+4))
+	if err != nil {
+		return "", "", false
+	}
+	if tflag := raw[2*rt.ptrSize+4]; raw[2*rt.ptrSize+7]&kindMask != kindStruct ||
+		tflag&tflagUncommon == 0 || tflag&tflagNamed == 0 {
+		return "", "", false
+	}
+	fieldsPtr := rt.word(raw[hdr+rt.ptrSize:])
+	fieldsLen := rt.word(raw[hdr+2*rt.ptrSize:])
+	fieldsCap := rt.word(raw[hdr+3*rt.ptrSize:])
+	if fieldsLen != fieldsCap || fieldsLen > maxStructFields ||
+		(fieldsLen > 0 && (fieldsPtr < rt.types || fieldsPtr >= rt.etypes)) {
+		return "", "", false
+	}
+	if str, ok = rt.typeString(addr, raw); !ok || !strings.Contains(str, ".") {
+		return "", "", false
+	}
+	pkgPath, ok = rt.resolveName(int32(rt.order.Uint32(raw[hdr+4*rt.ptrSize:])))
+	if !ok || pkgPath == "" {
+		return "", "", false
+	}
+	return pkgPath, str, true
+}
+
+// typeString returns the string representation of a type (e.g. *http.Request)
+func (rt *runtimeTypes) typeString(addr uint64, raw []byte) (string, bool) {
+	str, ok := rt.resolveName(int32(rt.order.Uint32(raw[4*rt.ptrSize+8:])))
+	if !ok || str == "" {
+		return "", false
+	}
+	if raw[2*rt.ptrSize+4]&tflagExtraStar != 0 {
+		str = str[1:]
+	}
+	return str, true
+}
+
+// resolveName reads a runtime name (internal/abi.Name) from its offset in the types region
+func (rt *runtimeTypes) resolveName(nameOff int32) (string, bool) {
+	if nameOff <= 0 || uint64(nameOff) >= rt.etypes-rt.types {
+		return "", false
+	}
+	return rt.readName(rt.types + uint64(nameOff))
+}
+
+// readName reads a runtime name (internal/abi.Name) from its address. The first byte of a name
+// is a flags field. Then the length is encoded as a varint since Go 1.17, and as a 2-bytes
+// big-endian integer before
+func (rt *runtimeTypes) readName(addr uint64) (string, bool) {
+	head, err := rt.mem.read(addr, 1+binary.MaxVarintLen32)
+	if err != nil {
+		return "", false
+	}
+	var length, lenSize uint64
+	if rt.goMinor >= 17 {
+		l, n := binary.Uvarint(head[1:])
+		if n <= 0 {
+			return "", false
+		}
+		length, lenSize = l, uint64(n)
+	} else {
+		length, lenSize = uint64(head[1])<<8|uint64(head[2]), 2
+	}
+	if length > 1<<16 {
+		return "", false
+	}
+	name, err := rt.mem.read(addr+1+lenSize, int(length))
+	if err != nil || !utf8.Valid(name) {
+		return "", false
+	}
+	return string(name), true
+}
+
+// header returns the raw bytes of the internal/abi.Type header, plus the following n bytes
+func (rt *runtimeTypes) header(addr, n uint64) ([]byte, error) {
+	return rt.mem.read(addr, int(rt.headerSize()+n))
+}
+
+// headerSize returns the size of the internal/abi.Type struct
+func (rt *runtimeTypes) headerSize() uint64 {
+	return 4*rt.ptrSize + 16
+}
+
+func (rt *runtimeTypes) kind(raw []byte) byte {
+	return raw[2*rt.ptrSize+7] & kindMask
+}
+
+// fields returns the fields of a struct type descriptor
+func (rt *runtimeTypes) fields(addr uint64) ([]runtimeField, error) {
+	hdr := rt.headerSize()
+	raw, err := rt.header(addr, 4*rt.ptrSize)
+	if err != nil {
+		return nil, err
+	}
+	if rt.kind(raw) != kindStruct {
+		return nil, errors.New("not a struct type")
+	}
+	fieldsPtr := rt.word(raw[hdr+rt.ptrSize:])
+	fieldsLen := rt.word(raw[hdr+2*rt.ptrSize:])
+	if fieldsLen > maxStructFields {
+		return nil, errors.New("invalid number of struct fields")
+	}
+	fieldsRaw, err := rt.mem.read(fieldsPtr, int(fieldsLen*3*rt.ptrSize))
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]runtimeField, 0, fieldsLen)
+	for i := uint64(0); i < fieldsLen; i++ {
+		f := fieldsRaw[i*3*rt.ptrSize:]
+		nameAddr := rt.word(f)
+		name, ok := rt.readName(nameAddr)
+		if !ok {
+			return nil, fmt.Errorf("invalid name for field %d", i)
+		}
+		offset := rt.word(f[2*rt.ptrSize:])
+		if rt.goMinor < 19 {
+			// before Go 1.19, the lower bit of the offset is the embedded flag
+			offset >>= 1
+		}
+		fields = append(fields, runtimeField{name: name, offset: offset, typ: rt.word(f[rt.ptrSize:])})
+	}
+	return fields, nil
+}
+
+func (rt *runtimeTypes) field(structAddr uint64, structName, name string) (runtimeField, error) {
+	fields, err := rt.fields(structAddr)
+	if err != nil {
+		return runtimeField{}, err
+	}
+	for _, f := range fields {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return runtimeField{}, &ErrFieldNotFound{Struct: structName, Field: name}
+}
+
+// pointerElem returns the type descriptor address of the element of a pointer type
+func (rt *runtimeTypes) pointerElem(addr uint64) (uint64, error) {
+	raw, err := rt.header(addr, rt.ptrSize)
+	if err != nil {
+		return 0, err
+	}
+	if rt.kind(raw) != kindPtr {
+		return 0, errors.New("not a pointer type")
+	}
+	return rt.word(raw[rt.headerSize():]), nil
+}
+
+// typeNameAndSize returns the name of a type descriptor, qualified with the package path
+// as it is in the DWARF data, and the size of the type
+func (rt *runtimeTypes) typeNameAndSize(addr uint64) (string, uint64, error) {
+	raw, err := rt.header(addr, 3*rt.ptrSize)
+	if err != nil {
+		return "", 0, err
+	}
+	size := rt.word(raw)
+	name, err := rt.typeName(addr, raw, 0)
+	return name, size, err
+}
+
+func (rt *runtimeTypes) typeName(addr uint64, raw []byte, depth int) (string, error) {
+	str, ok := rt.typeString(addr, raw)
+	if !ok {
+		return "", fmt.Errorf("invalid type name at 0x%x", addr)
+	}
+	hdr := rt.headerSize()
+	kind := rt.kind(raw)
+	if tflag := raw[2*rt.ptrSize+4]; tflag&tflagNamed != 0 {
+		// replace the package name by the package path
+		if uncommon, ok := rt.uncommonOffset(kind); ok && tflag&tflagUncommon != 0 {
+			u, err := rt.mem.read(addr+uncommon, 4)
+			if err != nil {
+				return "", err
+			}
+			if pkgPath, ok := rt.resolveName(int32(rt.order.Uint32(u))); ok && pkgPath != "" {
+				return pkgPath + "." + unqualifiedName(str), nil
+			}
+		}
+		// otherwise, guess the package path from the name of the package
+		if pkgName, _, ok := strings.Cut(str, "."); ok && rt.packages[pkgName] != "" {
+			return rt.packages[pkgName] + "." + unqualifiedName(str), nil
+		}
+		return str, nil
+	}
+	if depth > 8 {
+		return str, nil
+	}
+	var prefix string
+	switch kind {
+	case kindPtr:
+		prefix = "*"
+	case kindSlice:
+		prefix = "[]"
+	case kindArray:
+		prefix = fmt.Sprintf("[%d]", rt.word(raw[hdr+2*rt.ptrSize:]))
+	default:
+		return str, nil
+	}
+	elem := rt.word(raw[hdr:])
+	elemRaw, err := rt.header(elem, 3*rt.ptrSize)
+	if err != nil {
+		return "", err
+	}
+	elemName, err := rt.typeName(elem, elemRaw, depth+1)
+	if err != nil {
+		return "", err
+	}
+	return prefix + elemName, nil
+}
+
+// uncommonOffset returns the offset of the internal/abi.UncommonType of a type descriptor,
+// which follows the kind-specific type descriptor structure
+func (rt *runtimeTypes) uncommonOffset(kind byte) (uint64, bool) {
+	hdr := rt.headerSize()
+	switch kind {
+	case kindStruct, kindIface:
+		return hdr + 4*rt.ptrSize, true
+	case kindPtr, kindSlice:
+		return hdr + rt.ptrSize, true
+	case kindArray:
+		return hdr + 3*rt.ptrSize, true
+	case kindChan:
+		return hdr + 2*rt.ptrSize, true
+	case kindFunc:
+		// inCount and outCount uint16 fields, aligned to the pointer size
+		return hdr + rt.ptrSize, true
+	case kindMap:
+		// the layout of maps changes across Go versions
+		return 0, false
+	}
+	// basic types do not have any extra field
+	return hdr, true
+}
+
+// findOffsets returns the offsets of the data members from the type descriptors
+func (rt *runtimeTypes) findOffsets(dm *DataMember) (*DataMemberOffset, error) {
+	structAddr, ok := rt.structs[dm.StructName]
+	if !ok {
+		return nil, &ErrStructNotFound{Struct: dm.StructName}
+	}
+	raw, err := rt.header(structAddr, 0)
+	if err != nil {
+		return nil, err
+	}
+	hops := []Hop{{Field: dm.Field}}
+	if IsFieldPath(dm.Field) {
+		if hops, err = parseFieldPath(dm.Field); err != nil {
+			return nil, err
+		}
+	}
+	addr, structName := structAddr, dm.StructName
+	var f runtimeField
+	for i := range hops {
+		if f, err = rt.field(addr, structName, hops[i].Field); err != nil {
+			return nil, err
+		}
+		hops[i].Offset = f.offset
+		addr = f.typ
+		if hops[i].Deref {
+			if addr, err = rt.pointerElem(addr); err != nil {
+				return nil, fmt.Errorf("%s: %w", hops[i].Field, err)
+			}
+		}
+		if i < len(hops)-1 {
+			structName, _, _ = rt.typeNameAndSize(addr)
+		}
+	}
+	dmo := &DataMemberOffset{
+		DataMember: dm,
+		Offset:     f.offset,
+		StructSize: rt.word(raw),
+	}
+	if len(hops) > 1 {
+		dmo.Hops = hops
+		dmo.Offset = PathOffset(hops)
+	}
+	if dmo.Type, dmo.Size, err = rt.typeNameAndSize(f.typ); err != nil {
+		return nil, err
+	}
+	return dmo, nil
+}
+
+func (rt *runtimeTypes) word(b []byte) uint64 {
+	if rt.ptrSize == 4 {
+		return uint64(rt.order.Uint32(b))
+	}
+	return rt.order.Uint64(b)
+}
+
+func (rt *runtimeTypes) readWord(addr uint64) (uint64, error) {
+	b, err := rt.mem.read(addr, int(rt.ptrSize))
+	if err != nil {
+		return 0, err
+	}
+	return rt.word(b), nil
+}
+
+// unqualifiedName removes the package name from a type string (e.g. http.Request -> Request)
+func unqualifiedName(str string) string {
+	end := len(str)
+	if idx := strings.IndexByte(str, '['); idx >= 0 {
+		// ignore the type parameters of generic types
+		end = idx
+	}
+	if idx := strings.IndexByte(str[:end], '.'); idx >= 0 {
+		return str[idx+1:]
+	}
+	return str
+}
+
+// memory provides access to the loadable segments of an ELF file by their virtual address
+type memory struct {
+	elfF *elf.File
+	// segments are lazily read, and they can be read concurrently
+	mu       sync.Mutex
+	segments map[*elf.Prog][]byte
+}
+
+func (m *memory) segment(addr uint64) *elf.Prog {
+	for _, p := range m.elfF.Progs {
+		if p.Type == elf.PT_LOAD && addr >= p.Vaddr && addr < p.Vaddr+p.Filesz {
+			return p
+		}
+	}
+	return nil
+}
+
+func (m *memory) contains(addr uint64) bool {
+	return m.segment(addr) != nil
+}
+
+func (m *memory) read(addr uint64, n int) ([]byte, error) {
+	p := m.segment(addr)
+	if p == nil {
+		return nil, fmt.Errorf("address 0x%x is not in any loadable segment", addr)
+	}
+	m.mu.Lock()
+	data, ok := m.segments[p]
+	if !ok {
+		data = make([]byte, p.Filesz)
+		if _, err := p.ReadAt(data, 0); err != nil {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("reading segment at 0x%x: %w", p.Vaddr, err)
+		}
+		m.segments[p] = data
+	}
+	m.mu.Unlock()
+	start := addr - p.Vaddr
+	if start+uint64(n) > uint64(len(data)) {
+		return nil, fmt.Errorf("address 0x%x+%d is out of its segment", addr, n)
+	}
+	return data[start : start+uint64(n)], nil
+}
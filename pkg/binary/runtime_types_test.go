@@ -0,0 +1,95 @@
+package binary
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeTypes_MatchDWARF(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	dir := t.TempDir()
+	withDWARF := filepath.Join(dir, "prog")
+	stripped := filepath.Join(dir, "prog-stripped")
+	buildProgram(t, withDWARF)
+	buildProgram(t, stripped, "-ldflags=-s -w")
+
+	dms := []*DataMember{
+		{StructName: "main.outer", Field: "Flag"},
+		{StructName: "main.outer", Field: "inner.Name"},
+		{StructName: "main.outer", Field: "Ref"},
+		{StructName: "main.outer", Field: "Ref->Name"},
+		{StructName: "main.outer", Field: "Tags"},
+		{StructName: "main.outer", Field: "Attrs"},
+		{StructName: "main.outer", Field: "URL"},
+		{StructName: "main.outer", Field: "URL->Path"},
+		{StructName: "main.outer", Field: "Hash"},
+		{StructName: "net/url.URL", Field: "User"},
+	}
+	fromDWARF := findOffsetsInFile(t, withDWARF, dms)
+	fromRuntime := findOffsetsInFile(t, stripped, dms)
+	require.Len(t, fromRuntime.DataMembers, len(dms))
+	for i, dmo := range fromRuntime.DataMembers {
+		assert.Truef(t, fromDWARF.DataMembers[i].Equal(dmo), "%s %s: expected %+v. Got %+v",
+			dmo.StructName, dmo.Field, *fromDWARF.DataMembers[i], *dmo)
+	}
+
+	f, err := os.Open(stripped)
+	require.NoError(t, err)
+	defer f.Close()
+	elfF, err := elf.NewFile(f)
+	require.NoError(t, err)
+	_, err = elfF.DWARF()
+	require.Error(t, err, "the stripped executable should not contain DWARF data")
+	_, err = FindOffsets("v1.0.0", f, []*DataMember{{StructName: "main.outer", Field: "Unknown"}})
+	assert.Error(t, err)
+}
+
+func TestRuntimeTypes_ModuleData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	stripped := filepath.Join(t.TempDir(), "prog-stripped")
+	buildProgram(t, stripped, "-ldflags=-s -w")
+	f, err := os.Open(stripped)
+	require.NoError(t, err)
+	defer f.Close()
+	elfF, err := elf.NewFile(f)
+	require.NoError(t, err)
+
+	// the moduledata layout is selected by the Go version of the build info
+	rt, err := newRuntimeTypes(elfF, f)
+	require.NoError(t, err)
+	assert.Less(t, rt.types, rt.etypes)
+	assert.Contains(t, rt.structs, "main.outer")
+
+	if rt.goMinor >= 27 {
+		// the typedesclen field, which is placed before etypes, is not a valid end of the type descriptors
+		rt.goMinor = 26
+		assert.Error(t, rt.findModuleData())
+	}
+}
+
+func buildProgram(t *testing.T, out string, args ...string) {
+	args = append([]string{"build", "-o", out}, args...)
+	cmd := exec.Command("go", append(args, "./testdata/runtimetypes")...)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "CGO_ENABLED=0")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+}
+
+func findOffsetsInFile(t *testing.T, path string, dms []*DataMember) *Result {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	res, err := FindOffsets("v1.0.0", f, dms)
+	require.NoError(t, err)
+	return res
+}
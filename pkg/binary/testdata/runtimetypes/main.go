@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+type inner struct {
+	ID   int32
+	Name string
+}
+
+type outer struct {
+	Flag bool
+	inner
+	Ref   *inner
+	Tags  []string
+	Attrs map[string]int
+	URL   *url.URL
+	Hash  [4]uint32
+}
+
+func main() {
+	fmt.Println(&outer{Ref: &inner{}, URL: &url.URL{}})
+}
@@ -1,11 +1,9 @@
 package cache
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"errors"
+	"io/fs"
 	"log"
-	"os"
 
 	"github.com/hashicorp/go-version"
 
@@ -19,63 +17,112 @@ type Cache struct {
 }
 
 func NewCache(prevOffsetFile string) *Cache {
-	f, err := os.Open(prevOffsetFile)
-	if err != nil {
-		fmt.Println("could not find existing offset file, cache will be empty")
+	// offsets.Open sorts the offsets and sizes, as the search algorithm expects
+	track, err := offsets.Open(prevOffsetFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Println("could not find existing offset file, cache will be empty")
 		return nil
 	}
-
-	defer f.Close()
-	data, err := ioutil.ReadAll(f)
 	if err != nil {
 		log.Printf("error reading existing offsets file: %v. Ignoring existing file.\n", err)
 		return nil
 	}
 
-	var offsets offsets.Track
-	err = json.Unmarshal(data, &offsets)
-	if err != nil {
-		log.Printf("error parsing existing offsets file: %v Ignoring existing file.\n", err)
-		return nil
-	}
-
 	return &Cache{
-		data: &offsets,
+		data: track,
 	}
 }
 
-// IsAllInCache checks whether the passed datamembers exist in the cache for a given version
-func (c *Cache) IsAllInCache(version string, dataMembers []*binary.DataMember) ([]*binary.DataMemberOffset, bool) {
+// Find returns the offsets of the passed datamembers that exist in the cache for a given library version
+// and architecture, as well as the datamembers that are missing from the cache
+func (c *Cache) Find(lib, version, arch string, dataMembers []*binary.DataMember) ([]*binary.DataMemberOffset, []*binary.DataMember) {
 	var results []*binary.DataMemberOffset
+	var missing []*binary.DataMember
 	for _, dm := range dataMembers {
-		// first, look for the field and check that the target version is in chache
-		strct, ok := c.data.Data[dm.StructName]
-		if !ok {
-			return nil, false
-		}
-		field, ok := strct[dm.Field]
-		if !ok {
-			return nil, false
+		if !dm.AppliesTo(version) {
+			// the analysis would ignore it anyway
+			continue
 		}
-		if !versions.Between(version, field.Versions.Oldest, field.Versions.Newest) {
-			return nil, false
+		if dmo, ok := c.find(lib, version, arch, dm); ok {
+			results = append(results, dmo)
+		} else {
+			missing = append(missing, dm)
 		}
+	}
+	return results, missing
+}
 
-		off, ok := searchOffset(field, version)
-		if !ok {
+func (c *Cache) find(lib, version, arch string, dm *binary.DataMember) (*binary.DataMemberOffset, bool) {
+	module, fieldVersion, ok := c.structVersion(lib, version, dm.StructName)
+	if !ok {
+		return nil, false
+	}
+	// first, look for the field and check that the target version is in chache
+	strct, ok := c.data.Data[dm.StructName]
+	if !ok {
+		return nil, false
+	}
+	field, ok := strct[dm.Field]
+	if !ok {
+		return nil, false
+	}
+	// each architecture might have been analyzed for a different versions range
+	vi, ok := field.VersionsArch(arch)
+	if !ok || !versions.Between(fieldVersion, vi.Oldest, vi.Newest) {
+		return nil, false
+	}
+
+	od, ok := searchOffset(field, fieldVersion, arch)
+	// offsets from files generated before the types were tracked need to be retrieved
+	// again. Otherwise, they would be annotated as a type change in the output file
+	if !ok || (od.Type == "" && !od.Absent) {
+		return nil, false
+	}
+	// fields that were recorded as absent need to be retrieved again if they are not optional anymore
+	if od.Absent {
+		if !dm.Optional {
 			return nil, false
 		}
-		results = append(results, &binary.DataMemberOffset{
-			DataMember: dm,
-			Offset:     off,
-		})
+		return &binary.DataMemberOffset{DataMember: dm, Absent: true}, true
+	}
+	dmo := &binary.DataMemberOffset{
+		DataMember: dm,
+		Offset:     od.Offset,
+		Hops:       binaryHops(od.Path),
+		Size:       od.Size,
+		Type:       od.Type,
+	}
+	dmo.StructSize, _ = c.data.StructSize(arch, dm.StructName, fieldVersion)
+	if module != "" {
+		dmo.Module, dmo.ModuleVersion = module, fieldVersion
+	}
+	return dmo, true
+}
+
+// structVersion returns the version that the offsets of a struct refer to, for a given library version.
+// If the struct belongs to a dependency of the library, it returns the dependency module and the
+// version of that module that was linked into the library version. It returns false if the
+// version of the dependency is unknown
+func (c *Cache) structVersion(lib, libVersion, structName string) (string, string, bool) {
+	modules := []string{lib}
+	for mod := range c.data.Modules {
+		modules = append(modules, mod)
+	}
+	switch module := offsets.ModuleOf(offsets.StructPackage(structName), modules); module {
+	case lib, offsets.GoStdLib:
+		return "", libVersion, true
+	case "":
+		// files generated before the dependencies were tracked used the library versions
+		return "", "", false
+	default:
+		modVersion, ok := c.data.Modules[module].Seen[offsets.SeenKey(lib, libVersion)]
+		return module, modVersion, ok
 	}
-	return results, true
 }
 
 // searchOffset searches an offset from the newest field whose version
-// is lower than or equal to the target version
-func searchOffset(field offsets.Field, targetVersion string) (uint64, bool) {
+// is lower than or equal to the target version, for the given architecture
+func searchOffset(field offsets.Field, targetVersion, arch string) (*offsets.Versioned, bool) {
 	targetVersion = versions.CleanVersion(targetVersion)
 
 	target := versions.OrZero(targetVersion)
@@ -83,17 +130,31 @@ func searchOffset(field offsets.Field, targetVersion string) (uint64, bool) {
 	// Search from the newest version
 	for o := len(field.Offsets) - 1; o >= 0; o-- {
 		od := &field.Offsets[o]
+		if offsets.ArchOrDefault(od.Arch) != offsets.ArchOrDefault(arch) {
+			continue
+		}
 		fieldVersion, err := version.NewVersion(od.Since)
 		if err != nil {
 			// Malformed version: return not found
-			return 0, false
+			return nil, false
 		}
 		if target.Compare(fieldVersion) >= 0 {
 			// if target version is larger or equal than lib version:
 			// we certainly know that it is the most recent tracked offset
-			return od.Offset, true
+			return od, true
 		}
 	}
 
-	return 0, false
+	return nil, false
+}
+
+func binaryHops(path []offsets.Hop) []binary.Hop {
+	if len(path) == 0 {
+		return nil
+	}
+	hops := make([]binary.Hop, 0, len(path))
+	for _, h := range path {
+		hops = append(hops, binary.Hop{Field: h.Field, Offset: h.Offset, Deref: h.Deref})
+	}
+	return hops
 }
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+func TestFind_Partial(t *testing.T) {
+	track, err := offsets.Read(bytes.NewBufferString(`{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"offsets": [ { "offset": 0, "since": "1.12.0", "size": 16, "type": "string" } ]
+			}
+		}
+	}
+}`))
+	require.NoError(t, err)
+	c := &Cache{data: track}
+
+	method := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	url := &binary.DataMember{StructName: "net/http.Request", Field: "URL"}
+	found, missing := c.Find(offsets.GoStdLib, "1.20.0", "amd64", []*binary.DataMember{method, url})
+	require.Len(t, found, 1)
+	assert.Same(t, method, found[0].DataMember)
+	assert.EqualValues(t, 16, found[0].Size)
+	assert.Equal(t, []*binary.DataMember{url}, missing)
+
+	// versions out of the tracked range are missing
+	found, missing = c.Find(offsets.GoStdLib, "1.22.0", "amd64", []*binary.DataMember{method, url})
+	assert.Empty(t, found)
+	assert.Equal(t, []*binary.DataMember{method, url}, missing)
+}
+
+func TestNewCache_Unsorted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	assert.Nil(t, NewCache(file))
+
+	// the offsets of files that were edited by hand might not be sorted
+	require.NoError(t, os.WriteFile(file, []byte(`{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"offsets": [
+					{ "offset": 8, "since": "1.20.0", "type": "string" },
+					{ "offset": 0, "since": "1.12.0", "type": "string" }
+				]
+			}
+		}
+	}
+}`), 0o644))
+	c := NewCache(file)
+	require.NotNil(t, c)
+	method := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	found, _ := c.Find(offsets.GoStdLib, "1.13.0", "amd64", []*binary.DataMember{method})
+	require.Len(t, found, 1)
+	assert.EqualValues(t, 0, found[0].Offset)
+	found, _ = c.Find(offsets.GoStdLib, "1.21.0", "amd64", []*binary.DataMember{method})
+	require.Len(t, found, 1)
+	assert.EqualValues(t, 8, found[0].Offset)
+}
+
+func TestFind_ArchVersions(t *testing.T) {
+	track, err := offsets.Read(bytes.NewBufferString(`{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"arch_versions": {
+					"amd64": { "oldest": "1.12.0", "newest": "1.21.0" },
+					"arm64": { "oldest": "1.18.0", "newest": "1.21.0" }
+				},
+				"offsets": [
+					{ "offset": 0, "since": "1.12.0", "type": "string" },
+					{ "offset": 0, "since": "1.18.0", "arch": "arm64", "type": "string" }
+				]
+			}
+		}
+	}
+}`))
+	require.NoError(t, err)
+	c := &Cache{data: track}
+	method := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+
+	found, _ := c.Find(offsets.GoStdLib, "1.15.0", "amd64", []*binary.DataMember{method})
+	assert.Len(t, found, 1)
+	found, _ = c.Find(offsets.GoStdLib, "1.20.0", "arm64", []*binary.DataMember{method})
+	assert.Len(t, found, 1)
+	// the versions that were only analyzed for amd64 are missing for arm64 and for other architectures
+	found, missing := c.Find(offsets.GoStdLib, "1.15.0", "arm64", []*binary.DataMember{method})
+	assert.Empty(t, found)
+	assert.Equal(t, []*binary.DataMember{method}, missing)
+	found, _ = c.Find(offsets.GoStdLib, "1.20.0", "386", []*binary.DataMember{method})
+	assert.Empty(t, found)
+}
@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"io"
@@ -9,13 +10,22 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 	"text/template"
+	"time"
+	"unicode"
+
+	"golang.org/x/mod/module"
 
 	"github.com/grafana/go-offsets-tracker/pkg/utils"
 )
 
 const appName = "testapp"
 
+// BuildTimeout is the maximum duration of each command that downloads the dependencies
+// of the application that wraps the analyzed module, or that builds it
+var BuildTimeout = 30 * time.Minute
+
 var (
 	//go:embed wrapper/go.mod.txt
 	goMod string
@@ -24,8 +34,30 @@ var (
 	goMain string
 )
 
-func DownloadBinary(modName string, version string, inspectFile string, packages []string) (string, string, error) {
-	dir, err := ioutil.TempDir("", appName)
+// ErrBuildFailed is returned when the application that wraps the analyzed module can't be built
+type ErrBuildFailed struct {
+	Command string
+	// Output of the failed command
+	Output string
+	Err    error
+}
+
+func (e *ErrBuildFailed) Error() string {
+	return e.Command + ": " + e.Err.Error()
+}
+
+func (e *ErrBuildFailed) Unwrap() error {
+	return e.Err
+}
+
+// DownloadBinary builds a Go application for the goarch architecture that imports the provided module version
+// and returns the path to the executable and to the temporary directory where it has been built. The temporary
+// directory is created inside workDir, or in the default temporary directory if workDir is empty.
+func DownloadBinary(workDir, modName, version, goarch, inspectFile string, packages []string) (string, string, error) {
+	if err := checkWrapperInput(modName, version, packages); err != nil {
+		return "", "", err
+	}
+	dir, err := MkdirTemp(workDir, appName)
 	if err != nil {
 		return "", "", err
 	}
@@ -72,17 +104,52 @@ func DownloadBinary(modName string, version string, inspectFile string, packages
 		}
 	}
 
-	output, err := utils.RunCommand("go mod tidy -compat=1.17", dir)
+	err = runBuildCommand(&utils.Command{Name: "go", Args: []string{"mod", "tidy", "-compat=1.17"}, Dir: dir})
 	if err != nil {
-		log.Println("go mod tidy returned error: \n", output)
 		return "", "", err
 	}
 
-	output, err = utils.RunCommand("GOOS=linux GOARCH=amd64 go build", dir)
+	err = runBuildCommand(&utils.Command{
+		Name: "go",
+		Args: []string{"build"},
+		Env:  []string{"GOOS=linux", "GOARCH=" + goarch},
+		Dir:  dir,
+	})
 	if err != nil {
-		log.Println("go build returned error: \n", output)
 		return "", "", err
 	}
 
 	return path.Join(dir, appName), dir, nil
 }
+
+// checkWrapperInput verifies the module, version and packages that are written into the go.mod and
+// main.go files of the application that wraps the analyzed module, as they come from the input file
+func checkWrapperInput(modName, version string, packages []string) error {
+	if err := module.CheckPath(modName); err != nil {
+		return err
+	}
+	// the version might also be a branch name or a commit hash
+	if version == "" || strings.HasPrefix(version, "-") ||
+		strings.IndexFunc(version, func(r rune) bool { return !unicode.IsPrint(r) || unicode.IsSpace(r) || r == '"' }) >= 0 {
+		return fmt.Errorf("invalid version for %s: %q", modName, version)
+	}
+	for _, pkg := range packages {
+		if err := module.CheckImportPath(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBuildCommand runs a command to build the application that wraps the analyzed module,
+// with the BuildTimeout. If it fails, it returns an ErrBuildFailed with the standard error output
+func runBuildCommand(cmd *utils.Command) error {
+	ctx, cancel := context.WithTimeout(context.Background(), BuildTimeout)
+	defer cancel()
+	_, stderr, err := cmd.Run(ctx)
+	if err != nil {
+		log.Printf("%s returned error:\n%s", cmd, stderr)
+		return &ErrBuildFailed{Command: cmd.String(), Output: stderr, Err: err}
+	}
+	return nil
+}
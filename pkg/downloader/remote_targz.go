@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
-	"net/http"
 	"os"
 	"path"
 	"runtime"
@@ -15,57 +13,83 @@ import (
 	"github.com/grafana/go-offsets-tracker/pkg/utils"
 )
 
-const (
-	urlPattern = "https://go.dev/dl/go%s.%s-%s.tar.gz"
-)
-
 var (
 	//go:embed wrapper/gostd.mod.txt
 	goSTDMod string
 )
 
-func DownloadBinaryFromRemote(inspectFile string, version string) (string, string, error) {
-	dir, err := os.MkdirTemp("", version)
-	if err != nil {
-		return "", "", err
-	}
-	dest, err := os.Create(path.Join(dir, "go.tar.gz"))
-	if err != nil {
-		return "", "", err
+// ErrNotAvailable is returned when the Go distribution is not published for the requested
+// version and architecture (e.g. riscv64 before Go 1.14)
+type ErrNotAvailable struct {
+	URL string
+}
+
+func (e *ErrNotAvailable) Error() string {
+	return "Go distribution not available: " + e.URL
+}
+
+// tarballArch returns the architecture name of the Go distribution files for a given GOARCH
+func tarballArch(goarch string) string {
+	if goarch == "arm" {
+		return "armv6l"
 	}
-	defer dest.Close()
+	return goarch
+}
 
-	goos, goarch := runtime.GOOS, runtime.GOARCH
+// DownloadBinaryFromRemote gets the provided Go version from the toolchains cache. If inspectFile is empty, it
+// returns the path to the go executable for the goarch architecture. Otherwise, it returns the path to the
+// executable compiled for goarch from the inspectFile. The second returned value is the temporary directory to
+// remove after the analysis, if any. Temporary directories are created inside workDir, or in the default
+// temporary directory if workDir is empty.
+func DownloadBinaryFromRemote(workDir, inspectFile, version, goarch string, toolchains *ToolchainCache) (string, string, error) {
+	goos, distArch := runtime.GOOS, runtime.GOARCH
 	if inspectFile == "" {
 		// if we provide the inspection file, we actually need the localhost Go version
 		// to execute it as a compile
-		goos, goarch = "linux", "amd64"
+		goos, distArch = "linux", tarballArch(goarch)
 	}
-	// TODO: cache go versions so you don't need to download all of them each time
-	resp, err := http.Get(fmt.Sprintf(urlPattern, version, goos, goarch))
+	goRoot, release, err := toolchains.Acquire(version, goos, distArch)
 	if err != nil {
 		return "", "", err
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(dest, resp.Body)
-	if err != nil {
-		return "", "", err
+	defer release()
+
+	goCMD := path.Join(goRoot, "bin", "go")
+	if inspectFile == "" {
+		// copy the executable, as the cached toolchain might be evicted during the analysis
+		dir, err := MkdirTemp(workDir, version)
+		if err != nil {
+			return "", "", err
+		}
+		exe := path.Join(dir, "go")
+		if err := copyFile(goCMD, exe); err != nil {
+			RemoveTempDir(dir)
+			return "", "", err
+		}
+		return exe, dir, nil
 	}
+	return compileProvidedFile(workDir, version, goarch, goRoot, goCMD, inspectFile)
+}
 
-	output, err := utils.RunCommand("tar -xf go.tar.gz -C .", dir)
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
 	if err != nil {
-		log.Println("error uncompressing go.tar.gz:\n", output)
-		return "", "", err
+		return err
 	}
-	goCMD := fmt.Sprintf("%s/go/bin/go", dir)
-	if inspectFile == "" {
-		return goCMD, dir, nil
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
 	}
-	return compileProvidedFile(version, path.Join(dir, "go"), goCMD, inspectFile)
+	return out.Close()
 }
 
-func compileProvidedFile(goVersion, goRootDir, goCMD, inspectFile string) (string, string, error) {
-	dir, err := os.MkdirTemp("", appName)
+func compileProvidedFile(workDir, goVersion, goarch, goRootDir, goCMD, inspectFile string) (string, string, error) {
+	dir, err := MkdirTemp(workDir, appName)
 	if err != nil {
 		return "", "", err
 	}
@@ -84,15 +108,18 @@ func compileProvidedFile(goVersion, goRootDir, goCMD, inspectFile string) (strin
 		return "", "", fmt.Errorf("writing main file: %w", err)
 	}
 
-	output, err := utils.RunCommand("go mod tidy -compat=1.17", dir)
+	err = runBuildCommand(&utils.Command{Name: "go", Args: []string{"mod", "tidy", "-compat=1.17"}, Dir: dir})
 	if err != nil {
-		log.Printf("go mod tidy returned standard error:\n%s", output)
 		return "", "", err
 	}
 
-	output, err = utils.RunCommand(fmt.Sprintf(`GOROOT="%s" GOOS=linux GOARCH=amd64 %s build`, goRootDir, goCMD), dir)
+	err = runBuildCommand(&utils.Command{
+		Name: goCMD,
+		Args: []string{"build"},
+		Env:  []string{"GOROOT=" + goRootDir, "GOOS=linux", "GOARCH=" + goarch},
+		Dir:  dir,
+	})
 	if err != nil {
-		log.Printf("go build returned standard error:\n%s", output)
 		return "", "", err
 	}
 
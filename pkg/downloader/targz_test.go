@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarGz(t *testing.T, headers ...*tar.Header) []byte {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range headers {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write(bytes.Repeat([]byte{'a'}, int(hdr.Size)))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestExtractTarGz(t *testing.T) {
+	dst := t.TempDir()
+	require.NoError(t, extractTarGz(bytes.NewReader(tarGz(t,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "go/", Mode: 0o755},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "go/bin/go", Mode: 0o755, Size: 10},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "go/link", Linkname: "/etc/passwd"},
+	)), dst))
+
+	info, err := os.Stat(filepath.Join(dst, "go", "bin", "go"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, info.Size())
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	// links are not extracted
+	_, err = os.Lstat(filepath.Join(dst, "go", "link"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, name := range []string{"../escaped", "/abs/file"} {
+		err := extractTarGz(bytes.NewReader(tarGz(t,
+			&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: 1},
+		)), dst)
+		assert.Error(t, err, name)
+	}
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(dst), "escaped"))
+}
+
+func TestCheckWrapperInput(t *testing.T) {
+	assert.NoError(t, checkWrapperInput("google.golang.org/grpc", "v1.54.0", []string{"google.golang.org/grpc/internal/transport"}))
+	assert.NoError(t, checkWrapperInput("github.com/org/lib", "feature/my-branch", nil))
+	assert.Error(t, checkWrapperInput("-toolexec=/bin/sh", "v1.0.0", nil))
+	assert.Error(t, checkWrapperInput("github.com/org/lib", "v1.0.0\nreplace github.com/org/lib => ../lib", nil))
+	assert.Error(t, checkWrapperInput("github.com/org/lib", "v1.0.0", []string{`github.com/org/lib"; import "os`}))
+}
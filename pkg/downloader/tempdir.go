@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"os"
+	"sync"
+)
+
+// tempDirs registers the temporary directories that have been created, so
+// they can be removed if the process is interrupted
+var tempDirs = struct {
+	sync.Mutex
+	dirs map[string]struct{}
+}{dirs: map[string]struct{}{}}
+
+// MkdirTemp creates a temporary directory as os.MkdirTemp does, and registers
+// it to be removed by RemoveTempDirs.
+func MkdirTemp(dir, pattern string) (string, error) {
+	name, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	tempDirs.Lock()
+	tempDirs.dirs[name] = struct{}{}
+	tempDirs.Unlock()
+	return name, nil
+}
+
+// RemoveTempDir removes a directory that was created by MkdirTemp
+func RemoveTempDir(dir string) error {
+	tempDirs.Lock()
+	delete(tempDirs.dirs, dir)
+	tempDirs.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// RemoveTempDirs removes all the temporary directories that were created by MkdirTemp and not
+// removed yet. It is intended to clean up after the process is interrupted.
+func RemoveTempDirs() {
+	tempDirs.Lock()
+	defer tempDirs.Unlock()
+	for dir := range tempDirs.dirs {
+		os.RemoveAll(dir)
+		delete(tempDirs.dirs, dir)
+	}
+}
@@ -0,0 +1,284 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// toolchainsURL is the base URL of the Go distribution files
+var toolchainsURL = "https://go.dev/dl/"
+
+const (
+	// sizeFile stores the size in bytes of an extracted toolchain, to not walk it on each eviction
+	sizeFile = ".size"
+
+	// downloadPattern is the name pattern of the temporary directories where the toolchains are extracted
+	downloadPattern = ".download-*"
+
+	// DefaultToolchainsMaxSize is the default size limit of a ToolchainCache, in bytes
+	DefaultToolchainsMaxSize = 8 << 30
+)
+
+// ToolchainCache keeps the downloaded and extracted Go distributions in a directory, so they are
+// reused by later runs. Each distribution is verified against the SHA256 checksum that is published
+// in the go.dev website. When the total size of the extracted distributions exceeds the size limit,
+// the least recently used ones are removed.
+// A ToolchainCache can be used concurrently, but its directory must not be shared with other processes.
+type ToolchainCache struct {
+	dir     string
+	maxSize int64
+
+	checksumsOnce sync.Once
+	checksums     map[string]string
+	checksumsErr  error
+
+	mu sync.Mutex
+	// inUse key: toolchain name. Value: number of users that did not release the toolchain yet
+	inUse map[string]int
+	// locks avoid concurrent downloads of the same toolchain
+	locks map[string]*sync.Mutex
+}
+
+// DefaultToolchainsDir returns the default ToolchainCache directory, inside the user cache directory
+func DefaultToolchainsDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "go-offsets-tracker", "toolchains")
+}
+
+// NewToolchainCache creates a ToolchainCache in the provided directory, whose extracted
+// toolchains won't exceed maxSize bytes, unless they are in use
+func NewToolchainCache(dir string, maxSize int64) (*ToolchainCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating toolchains cache directory: %w", err)
+	}
+	// as the directory is not shared with other processes, any temporary download
+	// directory was left by a previous run that crashed
+	stale, err := filepath.Glob(filepath.Join(dir, downloadPattern))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range stale {
+		if err := os.RemoveAll(tmp); err != nil {
+			return nil, fmt.Errorf("removing stale toolchain download: %w", err)
+		}
+	}
+	return &ToolchainCache{
+		dir:     dir,
+		maxSize: maxSize,
+		inUse:   map[string]int{},
+		locks:   map[string]*sync.Mutex{},
+	}, nil
+}
+
+// Acquire returns the GOROOT of the Go distribution for the provided version, OS and architecture,
+// downloading it if it is not in the cache. The returned function must be invoked after
+// using the toolchain, so it can be evicted from the cache.
+func (tc *ToolchainCache) Acquire(version, goos, arch string) (string, func(), error) {
+	name := fmt.Sprintf("go%s.%s-%s", version, goos, arch)
+
+	tc.mu.Lock()
+	lock, ok := tc.locks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		tc.locks[name] = lock
+	}
+	tc.inUse[name]++
+	tc.mu.Unlock()
+	release := func() {
+		tc.mu.Lock()
+		tc.inUse[name]--
+		tc.mu.Unlock()
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	entry := filepath.Join(tc.dir, name)
+	if _, err := os.Stat(filepath.Join(entry, sizeFile)); err != nil {
+		if err := tc.download(name, entry); err != nil {
+			release()
+			return "", nil, err
+		}
+		tc.evict()
+	}
+	// the modification time of the entry tracks the last usage
+	now := time.Now()
+	if err := os.Chtimes(entry, now, now); err != nil {
+		release()
+		return "", nil, fmt.Errorf("updating toolchain usage time: %w", err)
+	}
+	return filepath.Join(entry, "go"), release, nil
+}
+
+// download fetches a Go distribution, verifies its checksum and extracts it into the entry directory
+func (tc *ToolchainCache) download(name, entry string) error {
+	tarball := name + ".tar.gz"
+	checksum, err := tc.checksum(tarball)
+	if err != nil {
+		return err
+	}
+
+	url := toolchainsURL + tarball
+	fmt.Printf("downloading %s\n", url)
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return &ErrNotAvailable{URL: url}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: unexpected status %s", url, resp.Status)
+	}
+
+	// extract into a temporary directory that is renamed once complete, so
+	// interrupted downloads do not leave broken entries in the cache
+	tmp, err := MkdirTemp(tc.dir, downloadPattern)
+	if err != nil {
+		return err
+	}
+	defer RemoveTempDir(tmp)
+	// the tarball is stored and hashed while it is downloaded, and only extracted once its checksum
+	// is verified, so the contents of unverified archives are never parsed
+	archive, err := os.Create(filepath.Join(tmp, tarball))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(archive, hash), resp.Body); err != nil {
+		return fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+		return fmt.Errorf("checksum mismatch for %s: downloaded %s, published %s", tarball, sum, checksum)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := extractTarGz(archive, tmp); err != nil {
+		return fmt.Errorf("extracting %s: %w", url, err)
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(archive.Name()); err != nil {
+		return err
+	}
+
+	size, err := dirSize(tmp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, sizeFile), []byte(strconv.FormatInt(size, 10)), 0o644); err != nil {
+		return err
+	}
+	// remove any previous incomplete entry
+	if err := os.RemoveAll(entry); err != nil {
+		return err
+	}
+	return os.Rename(tmp, entry)
+}
+
+// checksum returns the published SHA256 checksum of a Go distribution file
+func (tc *ToolchainCache) checksum(file string) (string, error) {
+	tc.checksumsOnce.Do(func() {
+		tc.checksums, tc.checksumsErr = versions.FindGoChecksums()
+	})
+	if tc.checksumsErr != nil {
+		return "", fmt.Errorf("fetching Go checksums: %w", tc.checksumsErr)
+	}
+	checksum, ok := tc.checksums[file]
+	if !ok {
+		return "", &ErrNotAvailable{URL: toolchainsURL + file}
+	}
+	return checksum, nil
+}
+
+type cachedToolchain struct {
+	name     string
+	size     int64
+	lastUsed time.Time
+}
+
+// evict removes the least recently used toolchains that are not in use,
+// until the total size of the cache does not exceed the limit
+func (tc *ToolchainCache) evict() {
+	entries, err := os.ReadDir(tc.dir)
+	if err != nil {
+		log.Printf("WARNING: can't list the toolchains cache: %v", err)
+		return
+	}
+	var toolchains []cachedToolchain
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sizeBytes, err := os.ReadFile(filepath.Join(tc.dir, e.Name(), sizeFile))
+		if err != nil {
+			// incomplete download
+			continue
+		}
+		size, _ := strconv.ParseInt(string(sizeBytes), 10, 64)
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		toolchains = append(toolchains, cachedToolchain{name: e.Name(), size: size, lastUsed: info.ModTime()})
+		total += size
+	}
+	sort.Slice(toolchains, func(i, j int) bool {
+		return toolchains[i].lastUsed.Before(toolchains[j].lastUsed)
+	})
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for _, t := range toolchains {
+		if total <= tc.maxSize {
+			return
+		}
+		if tc.inUse[t.name] > 0 {
+			continue
+		}
+		fmt.Printf("removing %s from the toolchains cache\n", t.name)
+		if err := os.RemoveAll(filepath.Join(tc.dir, t.name)); err != nil {
+			log.Printf("WARNING: can't remove cached toolchain %s: %v", t.name, err)
+			continue
+		}
+		total -= t.size
+	}
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDistribution returns a tar.gz file with a go/bin/go file of the provided size
+func fakeDistribution(t *testing.T, size int) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "go/bin/go", Mode: 0o755, Size: int64(size)}))
+	_, err := tw.Write(make([]byte, size))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestToolchainCache(t *testing.T) {
+	tarballs := map[string][]byte{
+		// the archive is not parsed until its checksum is verified
+		"go1.20.0.linux-amd64.tar.gz": []byte("not a tar.gz file"),
+		"go1.21.0.linux-amd64.tar.gz": fakeDistribution(t, 1000),
+		"go1.22.0.linux-amd64.tar.gz": fakeDistribution(t, 1000),
+	}
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tarball, ok := tarballs[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		downloads.Add(1)
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+	defaultURL := toolchainsURL
+	toolchainsURL = server.URL + "/"
+	defer func() { toolchainsURL = defaultURL }()
+
+	dir := t.TempDir()
+	// room for two toolchains
+	tc, err := NewToolchainCache(dir, 2500)
+	require.NoError(t, err)
+	tc.checksumsOnce.Do(func() {
+		tc.checksums = map[string]string{
+			// wrong checksum
+			"go1.20.0.linux-amd64.tar.gz": "0000",
+		}
+		for _, v := range []string{"go1.21.0.linux-amd64.tar.gz", "go1.22.0.linux-amd64.tar.gz"} {
+			sum := sha256.Sum256(tarballs[v])
+			tc.checksums[v] = hex.EncodeToString(sum[:])
+		}
+	})
+
+	goRoot, release, err := tc.Acquire("1.21.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(goRoot, "bin", "go"))
+	release()
+	// the toolchain is reused
+	_, release, err = tc.Acquire("1.21.0", "linux", "amd64")
+	require.NoError(t, err)
+	release()
+	assert.EqualValues(t, 1, downloads.Load())
+
+	_, _, err = tc.Acquire("1.20.0", "linux", "amd64")
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.NoDirExists(t, filepath.Join(dir, "go1.20.0.linux-amd64"))
+
+	_, _, err = tc.Acquire("1.19.0", "linux", "amd64")
+	var na *ErrNotAvailable
+	assert.ErrorAs(t, err, &na)
+
+	// the least recently used toolchain is evicted when the cache grows over its limit
+	_, release21, err := tc.Acquire("1.21.0", "linux", "amd64")
+	require.NoError(t, err)
+	_, release22, err := tc.Acquire("1.22.0", "linux", "amd64")
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(dir, "go1.21.0.linux-amd64"))
+	release21()
+	release22()
+
+	tarballs["go1.23.0.linux-amd64.tar.gz"] = fakeDistribution(t, 1000)
+	sum := sha256.Sum256(tarballs["go1.23.0.linux-amd64.tar.gz"])
+	tc.checksums["go1.23.0.linux-amd64.tar.gz"] = hex.EncodeToString(sum[:])
+	_, release, err = tc.Acquire("1.23.0", "linux", "amd64")
+	require.NoError(t, err)
+	release()
+	assert.NoDirExists(t, filepath.Join(dir, "go1.21.0.linux-amd64"))
+	assert.DirExists(t, filepath.Join(dir, "go1.22.0.linux-amd64"))
+	assert.DirExists(t, filepath.Join(dir, "go1.23.0.linux-amd64"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary download directories should remain")
+}
+
+func TestNewToolchainCache_RemovesStaleDownloads(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, ".download-123")
+	require.NoError(t, os.MkdirAll(filepath.Join(stale, "go", "bin"), 0o755))
+	entry := filepath.Join(dir, "go1.21.0.linux-amd64")
+	require.NoError(t, os.MkdirAll(entry, 0o755))
+
+	_, err := NewToolchainCache(dir, DefaultToolchainsMaxSize)
+	require.NoError(t, err)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, entry)
+}
@@ -0,0 +1,190 @@
+package generator
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+// cTable is a field offset or a struct size, with its values since each version
+type cTable struct {
+	// Struct is the qualified name of the struct
+	Struct string
+	// Field name, or empty if the table contains the sizes of the struct
+	Field string
+	// Name in snake case of the constant and the table in the C header (e.g. net_http_request_method)
+	Name string
+	// ID of the field or struct in the C header (e.g. GO_OFFSETS_NET_HTTP_REQUEST_METHOD)
+	ID string
+	// Start of the table intervals in the array that contains all the intervals
+	Start     int
+	Intervals []interval
+	// HeaderIntervals are the Intervals that apply to release versions, which are written to the header
+	HeaderIntervals []interval
+}
+
+// snakeCase returns a C identifier for a qualified struct name and an optional field name,
+// in lower snake case (e.g. net/http.Request + URL->Path returns net_http_request_url_path).
+// The names of the struct sizes are prefixed by "size_", so they don't collide with the fields
+func snakeCase(structName, fieldName string) string {
+	parts := strings.FieldsFunc(structName+"."+fieldName, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.ToLower(strings.Join(parts, "_"))
+}
+
+// maxCIntervals is the maximum number of intervals of a C header, whose positions are stored as __u16
+const maxCIntervals = 1<<16 - 1
+
+// cTables returns the tables of the offsets of all the fields, and of the sizes of all the structs,
+// for the provided architecture. It returns an error if two tables are given the same name, or if
+// the header can't contain all the intervals
+func cTables(track *offsets.Track, arch string) ([]*cTable, []*cTable, error) {
+	fs, err := fields(track)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := map[string]string{}
+	checkName := func(t *cTable) error {
+		if other, ok := names[t.Name]; ok {
+			return fmt.Errorf("%s %s and %s have the same C name %s", t.Struct, t.Field, other, t.Name)
+		}
+		names[t.Name] = t.Struct + " " + t.Field
+		return nil
+	}
+	var fieldTables, structTables []*cTable
+	start := 0
+	for _, f := range fs {
+		t := &cTable{Struct: f.Struct, Field: f.Field, Name: snakeCase(f.Struct, f.Field), Start: start}
+		if err := checkName(t); err != nil {
+			return nil, nil, err
+		}
+		for _, a := range f.Archs {
+			if a.Name != arch {
+				continue
+			}
+			t.Intervals = a.Intervals
+		}
+		t.HeaderIntervals = releaseIntervals(t.Intervals)
+		start += len(t.HeaderIntervals)
+		fieldTables = append(fieldTables, t)
+	}
+	for _, structName := range structNames(track) {
+		t := &cTable{Struct: structName, Name: "size_" + snakeCase(structName, ""), Start: start}
+		if err := checkName(t); err != nil {
+			return nil, nil, err
+		}
+		if t.Intervals, err = structSizes(track, arch, structName); err != nil {
+			return nil, nil, fmt.Errorf("%s size: %w", structName, err)
+		}
+		t.HeaderIntervals = releaseIntervals(t.Intervals)
+		start += len(t.HeaderIntervals)
+		structTables = append(structTables, t)
+	}
+	if start > maxCIntervals {
+		return nil, nil, fmt.Errorf("the %s offsets have %d intervals, but a C header can't contain more than %d",
+			arch, start, maxCIntervals)
+	}
+	for _, t := range fieldTables {
+		t.ID = "GO_OFFSETS_" + strings.ToUpper(t.Name)
+	}
+	for _, t := range structTables {
+		t.ID = "GO_OFFSETS_" + strings.ToUpper(t.Name)
+	}
+	return fieldTables, structTables, nil
+}
+
+// structSizes returns the sizes of a struct since each version where they changed
+func structSizes(track *offsets.Track, arch, structName string) ([]interval, error) {
+	var out []interval
+	for _, vs := range track.Structs[structName].Sizes {
+		if offsets.ArchOrDefault(vs.Arch) != arch || (len(out) > 0 && out[len(out)-1].Value == vs.Size) {
+			continue
+		}
+		iv, err := newInterval(vs.Since, vs.Size, false)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, iv)
+	}
+	return out, nil
+}
+
+// releaseIntervals returns the intervals that apply to the release versions, as the packed versions
+// of the C header can't contain prereleases. The interval of a prerelease applies since its release,
+// unless the release has its own interval
+func releaseIntervals(ivs []interval) []interval {
+	var out []interval
+	for _, iv := range ivs {
+		if n := len(out); n > 0 && out[n-1].Version == iv.Version {
+			out = out[:n-1]
+		}
+		if n := len(out); n > 0 && out[n-1].Value == iv.Value && out[n-1].Absent == iv.Absent {
+			continue
+		}
+		out = append(out, iv)
+	}
+	return out
+}
+
+func structNames(track *offsets.Track) []string {
+	names := make([]string, 0, len(track.Data))
+	for name := range track.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cData(track *offsets.Track, arch string) (map[string]interface{}, error) {
+	fieldTables, structTables, err := cTables(track, arch)
+	if err != nil {
+		return nil, err
+	}
+	maxIntervals, intervalsCount := 1, 0
+	for _, t := range append(fieldTables, structTables...) {
+		if len(t.HeaderIntervals) > maxIntervals {
+			maxIntervals = len(t.HeaderIntervals)
+		}
+		intervalsCount += len(t.HeaderIntervals)
+	}
+	return map[string]interface{}{
+		"Arch":           arch,
+		"Fields":         fieldTables,
+		"Structs":        structTables,
+		"MaxIntervals":   maxIntervals,
+		"IntervalsCount": intervalsCount,
+	}, nil
+}
+
+// CHeader writes a C header with the offsets of the Track for the given architecture, to be included
+// by eBPF programs. For each tracked field and struct, the header contains an ID, a table with the
+// field offsets or the struct sizes since each version, and a volatile const whose value can be
+// rewritten when the program is loaded, as returned by the helper written by CConstants.
+func CHeader(w io.Writer, track *offsets.Track, arch string) error {
+	data, err := cData(track, arch)
+	if err != nil {
+		return err
+	}
+	return templates.ExecuteTemplate(w, "offsets.h.txt", data)
+}
+
+// CConstants writes a Go package with a helper that returns the values of the volatile consts of the
+// C header that is written by CHeader, for the versions of the modules linked into a Go executable.
+// The values can be rewritten into the eBPF CollectionSpec before loading it.
+func CConstants(w io.Writer, track *offsets.Track, arch, pkgName string) error {
+	if !token.IsIdentifier(pkgName) {
+		return fmt.Errorf("invalid package name %q", pkgName)
+	}
+	data, err := cData(track, arch)
+	if err != nil {
+		return err
+	}
+	data["Package"] = pkgName
+	return writeGo(w, "constants.go.txt", data)
+}
@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+func TestCHeader(t *testing.T) {
+	track := testTrack()
+	track.Structs = map[string]offsets.StructInfo{"net/http.Request": {Sizes: []offsets.VersionedSize{
+		{Size: 248, Since: "1.12.0"}, {Size: 132, Since: "1.12.0", Arch: "386"}, {Size: 248, Since: "1.13.0"},
+	}}}
+
+	out := bytes.Buffer{}
+	require.NoError(t, CHeader(&out, track, offsets.DefaultArch))
+	header := out.String()
+	for _, expected := range []string{
+		"GO_OFFSETS_NET_HTTP_REQUEST_METHOD, // net/http.Request Method",
+		"GO_OFFSETS_NET_HTTP_REQUEST_URL_PATH, // net/http.Request URL->Path",
+		"GO_OFFSETS_SIZE_NET_HTTP_REQUEST, // net/http.Request",
+		"#define GO_OFFSETS_MAX_INTERVALS 2",
+		"#define GO_OFFSETS_INTERVALS_COUNT 4",
+		"{ GO_OFFSETS_VERSION(1, 11, 0), GO_OFFSETS_ABSENT },",
+		"{ GO_OFFSETS_VERSION(1, 12, 0), 56 },",
+		// the size of the struct is only annotated once, since the oldest version where it is known
+		"// net/http.Request size\n\t{ GO_OFFSETS_VERSION(1, 12, 0), 248 },\n\t{ 0, 0 },",
+		"[GO_OFFSETS_NET_HTTP_REQUEST_METHOD] = { 0, 1 },",
+		"[GO_OFFSETS_NET_HTTP_REQUEST_URL_PATH] = { 1, 2 },",
+		"[GO_OFFSETS_SIZE_NET_HTTP_REQUEST] = { 3, 1 },",
+		"volatile const __u64 go_offsets_net_http_request_url_path = GO_OFFSETS_NOT_TRACKED;",
+		"volatile const __u64 go_offsets_size_net_http_request = GO_OFFSETS_NOT_TRACKED;",
+	} {
+		assert.Contains(t, header, expected)
+	}
+
+	// other architectures only contain their own offsets
+	out.Reset()
+	require.NoError(t, CHeader(&out, track, "386"))
+	assert.Contains(t, out.String(), "[GO_OFFSETS_NET_HTTP_REQUEST_METHOD] = { 0, 1 },")
+	assert.Contains(t, out.String(), "[GO_OFFSETS_NET_HTTP_REQUEST_URL_PATH] = { 1, 0 },")
+}
+
+func TestCConstants(t *testing.T) {
+	out := bytes.Buffer{}
+	require.NoError(t, CConstants(&out, testTrack(), offsets.DefaultArch, "goffsets"))
+
+	_, err := parser.ParseFile(token.NewFileSet(), "constants.go", out.Bytes(), 0)
+	require.NoError(t, err)
+	src := out.String()
+	assert.Contains(t, src, `{name: "go_offsets_net_http_request_url_path", structName: "net/http.Request", entries: []entry{`)
+	assert.Contains(t, src, `{since: 0x1000b0000, absent: true}, // 1.11.0`)
+	assert.Contains(t, src, `{name: "go_offsets_size_net_http_request", structName: "net/http.Request", entries: []entry{}},`)
+
+	assert.Error(t, CConstants(&out, testTrack(), offsets.DefaultArch, "not-a-package"))
+}
+
+func TestCHeader_Prereleases(t *testing.T) {
+	track := runTrack()
+	track.Data["net/http.Request"]["Method"] = offsets.Field{Offsets: []offsets.Versioned{
+		{Offset: 0, Since: "1.12.0"}, {Offset: 8, Since: "1.13.0-rc.1"},
+	}}
+
+	out := bytes.Buffer{}
+	require.NoError(t, CHeader(&out, track, offsets.DefaultArch))
+	header := out.String()
+	// the packed versions of the header can't contain prereleases, so their offsets apply since their
+	// release, unless the release has its own offsets
+	assert.Contains(t, header, "// net/http.Request Method\n"+
+		"\t{ GO_OFFSETS_VERSION(1, 12, 0), 0 },\n\t{ GO_OFFSETS_VERSION(1, 13, 0), 8 },\n")
+	assert.Contains(t, header, "// net/http.Request Proto\n"+
+		"\t{ GO_OFFSETS_VERSION(1, 12, 0), 16 },\n\t{ GO_OFFSETS_VERSION(1, 22, 0), 32 },\n")
+	assert.Contains(t, header, "[GO_OFFSETS_NET_HTTP_REQUEST_PROTO] = { 2, 2 },")
+
+	// the Go helper compares the prereleases, and refuses to pack them
+	out.Reset()
+	require.NoError(t, CConstants(&out, track, offsets.DefaultArch, "goffsets"))
+	assert.Contains(t, out.String(), `{since: 0x100160000, pre: "rc.2", value: 24}, // 1.22.0-rc.2`)
+	assert.Contains(t, out.String(), `return packed, ok && pre == ""`)
+}
+
+func TestCHeader_Limits(t *testing.T) {
+	for _, since := range []string{"1.65536.0", "1.12.65536"} {
+		track := testTrack()
+		track.Data["net/http.Request"]["Method"] = offsets.Field{Offsets: []offsets.Versioned{{Since: since}}}
+		assert.ErrorContains(t, CHeader(&bytes.Buffer{}, track, offsets.DefaultArch), "can't be packed")
+	}
+
+	track := testTrack()
+	track.Structs = map[string]offsets.StructInfo{"net/http.Request": {}}
+	for i := 0; i < maxCIntervals; i++ {
+		track.Structs["net/http.Request"] = offsets.StructInfo{Sizes: append(track.Structs["net/http.Request"].Sizes,
+			offsets.VersionedSize{Size: uint64(i), Since: fmt.Sprintf("1.0.%d", i)})}
+	}
+	// the intervals of the fields don't fit anymore
+	assert.ErrorContains(t, CHeader(&bytes.Buffer{}, track, offsets.DefaultArch), "can't contain more than 65535")
+	// other architectures only contain their own intervals
+	assert.NoError(t, CHeader(&bytes.Buffer{}, track, "386"))
+}
+
+// bpfProgram includes the header as an eBPF program would do
+const bpfProgram = `typedef unsigned short __u16;
+typedef unsigned long long __u64;
+#define __always_inline inline __attribute__((always_inline))
+
+#include "offsets.h"
+
+__u64 request_url_path(__u64 version) {
+	__u64 offset = go_offsets_field(GO_OFFSETS_NET_HTTP_REQUEST_URL_PATH, version);
+	if (offset == GO_OFFSETS_NOT_TRACKED) {
+		offset = go_offsets_net_http_request_url_path;
+	}
+	return offset + go_offsets_struct_size(GO_OFFSETS_SIZE_NET_HTTP_REQUEST, version);
+}
+`
+
+func TestCHeader_Compile(t *testing.T) {
+	clang, err := exec.LookPath("clang")
+	if err != nil {
+		t.Skip("skipping test that requires clang")
+	}
+	track := testTrack()
+	track.Structs = map[string]offsets.StructInfo{"net/http.Request": {Sizes: []offsets.VersionedSize{
+		{Size: 248, Since: "1.12.0"},
+	}}}
+	dir := t.TempDir()
+	out := bytes.Buffer{}
+	require.NoError(t, CHeader(&out, track, offsets.DefaultArch))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "offsets.h"), out.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "prog.c"), []byte(bpfProgram), 0o644))
+
+	cmd := exec.Command(clang, "-target", "bpf", "-O2", "-Wall", "-Werror", "-c", "prog.c", "-o", "prog.o")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+}
@@ -0,0 +1,159 @@
+// Package generator compiles the offsets of a Track into source code that can be embedded
+// into the programs that consume the offsets, so they do not need to parse the offsets file.
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// field is a tracked struct field, with its offsets for each architecture
+type field struct {
+	Struct string
+	Field  string
+	// Ident is the exported identifier of the field in the generated code
+	Ident string
+	// Archs are sorted by name. Their offsets are sorted from older to newer version
+	Archs []arch
+}
+
+type arch struct {
+	Name      string
+	Intervals []interval
+}
+
+// interval is the value of a field offset or a struct size since a given version
+type interval struct {
+	Since string
+	// Major, Minor and Patch segments of the Since version, which are packed into Version
+	Major, Minor, Patch uint64
+	// Version is the packed Since version, as returned by the generated packVersion function
+	Version uint64
+	// Prerelease of the Since version, which is not part of the packed Version
+	Prerelease string
+	Value      uint64
+	Absent     bool
+}
+
+// maxMajor and maxMinorPatch are the highest version segments that can be packed into an integer
+const (
+	maxMajor      = 1<<32 - 1
+	maxMinorPatch = 1<<16 - 1
+)
+
+// newInterval packs the since version of an interval. It returns an error if any segment of the
+// version does not fit into the packed integer
+func newInterval(since string, value uint64, absent bool) (interval, error) {
+	segments := versions.MustParse(since).Segments64()
+	if segments[0] > maxMajor || segments[1] > maxMinorPatch || segments[2] > maxMinorPatch {
+		return interval{}, fmt.Errorf("version %s can't be packed: the major version can't be higher than %d, "+
+			"and the minor and patch versions can't be higher than %d", since, uint64(maxMajor), maxMinorPatch)
+	}
+	packed, pre, err := offsets.TableVersion(since)
+	if err != nil {
+		return interval{}, fmt.Errorf("version %s can't be packed: %w", since, err)
+	}
+	return interval{
+		Since: since, Major: packed >> 32, Minor: packed >> 16 & maxMinorPatch, Patch: packed & maxMinorPatch,
+		Version: packed, Prerelease: pre, Value: value, Absent: absent,
+	}, nil
+}
+
+// initialisms are written in upper case when they are a part of the generated identifiers
+var initialisms = map[string]bool{
+	"api": true, "dns": true, "grpc": true, "http": true, "id": true, "io": true, "ip": true,
+	"json": true, "rpc": true, "sql": true, "tcp": true, "tls": true, "udp": true, "uri": true,
+	"url": true,
+}
+
+// identifier returns an exported Go identifier for a field of a struct, joining the parts of the
+// qualified struct name and the field path in camel case (e.g. net/http.Request + URL->Path
+// returns NetHTTPRequestURLPath)
+func identifier(structName, fieldName string) string {
+	parts := strings.FieldsFunc(structName+"."+fieldName, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	ident := strings.Builder{}
+	for _, part := range parts {
+		// initialisms might be followed by a version number (e.g. http2)
+		if initialisms[strings.TrimRightFunc(strings.ToLower(part), unicode.IsDigit)] {
+			ident.WriteString(strings.ToUpper(part))
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		ident.WriteString(string(r))
+	}
+	if id := ident.String(); id != "" && unicode.IsLetter([]rune(id)[0]) {
+		return id
+	}
+	return "F" + ident.String()
+}
+
+// fields returns the tracked fields of the Track, sorted by struct and field name. It returns an
+// error if two fields are given the same identifier
+func fields(track *offsets.Track) ([]field, error) {
+	structNames := make([]string, 0, len(track.Data))
+	for name := range track.Data {
+		structNames = append(structNames, name)
+	}
+	sort.Strings(structNames)
+
+	var out []field
+	var err error
+	idents := map[string]string{}
+	for _, structName := range structNames {
+		strct := track.Data[structName]
+		fieldNames := make([]string, 0, len(strct))
+		for name := range strct {
+			fieldNames = append(fieldNames, name)
+		}
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			f := field{Struct: structName, Field: fieldName, Ident: identifier(structName, fieldName)}
+			if other, ok := idents[f.Ident]; ok {
+				return nil, fmt.Errorf("%s %s and %s have the same identifier %s",
+					structName, fieldName, other, f.Ident)
+			}
+			idents[f.Ident] = structName + " " + fieldName
+			if f.Archs, err = archs(strct[fieldName].Offsets); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", structName, fieldName, err)
+			}
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// archs groups the offsets of a field by architecture
+func archs(offs []offsets.Versioned) ([]arch, error) {
+	byArch := map[string][]offsets.Versioned{}
+	for _, od := range offs {
+		name := offsets.ArchOrDefault(od.Arch)
+		byArch[name] = append(byArch[name], od)
+	}
+	out := make([]arch, 0, len(byArch))
+	for name, offs := range byArch {
+		sort.SliceStable(offs, func(i, j int) bool {
+			return versions.MustParse(offs[i].Since).LessThan(versions.MustParse(offs[j].Since))
+		})
+		a := arch{Name: name}
+		for _, od := range offs {
+			iv, err := newInterval(od.Since, od.Offset, od.Absent)
+			if err != nil {
+				return nil, err
+			}
+			a.Intervals = append(a.Intervals, iv)
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"text/template"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+//go:embed templates/*.txt
+var templatesFS embed.FS
+
+var templates = template.Must(template.ParseFS(templatesFS, "templates/*.txt"))
+
+// Go writes a Go package with the offsets of the Track. For each tracked field, the package contains
+// a function that returns its offset for a given version, whose name is the qualified name of the
+// struct and the field in camel case (e.g. NetHTTPRequestMethod), and another function that also
+// accepts the architecture (e.g. NetHTTPRequestMethodArch). The offsets are compiled into the
+// package, so it does not need to read the offsets file.
+func Go(w io.Writer, track *offsets.Track, pkgName string) error {
+	if !token.IsIdentifier(pkgName) {
+		return fmt.Errorf("invalid package name %q", pkgName)
+	}
+	fs, err := fields(track)
+	if err != nil {
+		return err
+	}
+	return writeGo(w, "offsets.go.txt", map[string]interface{}{
+		"Package":     pkgName,
+		"DefaultArch": offsets.DefaultArch,
+		"Fields":      fs,
+	})
+}
+
+// writeGo executes a template that generates Go code, and writes the formatted code
+func writeGo(w io.Writer, tmpl string, data interface{}) error {
+	src := bytes.Buffer{}
+	if err := templates.ExecuteTemplate(&src, tmpl, data); err != nil {
+		return err
+	}
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+func testTrack() *offsets.Track {
+	return &offsets.Track{Data: map[string]offsets.Struct{
+		"net/http.Request": {
+			"Method": {Offsets: []offsets.Versioned{
+				{Offset: 0, Since: "1.12.0"},
+				{Offset: 8, Since: "1.12.0", Arch: "386"},
+			}},
+			"URL->Path": {Offsets: []offsets.Versioned{
+				{Since: "1.11.0", Absent: true},
+				{Offset: 56, Since: "1.12.0"},
+			}},
+		},
+	}}
+}
+
+func TestIdentifier(t *testing.T) {
+	assert.Equal(t, "NetHTTPRequestMethod", identifier("net/http.Request", "Method"))
+	assert.Equal(t, "NetHTTPRequestURLPath", identifier("net/http.Request", "URL->Path"))
+	assert.Equal(t, "GolangOrgXNetHTTP2FrameHeaderStreamID",
+		identifier("golang.org/x/net/http2.FrameHeader", "StreamID"))
+	assert.Equal(t, "GoogleGolangOrgGRPCInternalTransportStreamStreamCtx",
+		identifier("google.golang.org/grpc/internal/transport.Stream", "Stream.ctx"))
+}
+
+func TestGo(t *testing.T) {
+	out := bytes.Buffer{}
+	require.NoError(t, Go(&out, testTrack(), "goffsets"))
+
+	file, err := parser.ParseFile(token.NewFileSet(), "offsets.go", out.Bytes(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "goffsets", file.Name.Name)
+	src := out.String()
+	for _, expected := range []string{
+		"func NetHTTPRequestMethod(libVersion string) (uint64, bool) {",
+		"func NetHTTPRequestMethodArch(arch, libVersion string) (uint64, bool) {",
+		"func NetHTTPRequestURLPath(libVersion string) (uint64, bool) {",
+		`{arch: "386", entries: []entry{`,
+		`{since: 0x1000c0000, value: 8}, // 1.12.0`,
+		`{since: 0x1000b0000, absent: true}, // 1.11.0`,
+		`{since: 0x1000c0000, value: 56},    // 1.12.0`,
+	} {
+		assert.Contains(t, src, expected)
+	}
+	// the versions are compared as packed integers, without depending on other modules
+	require.Len(t, file.Imports, 1)
+	assert.Equal(t, `"strings"`, file.Imports[0].Path.Value)
+}
+
+// generatedTest checks the functions of the package generated from runTrack. The cases that are
+// compared with the offsets.Track lookups are appended to it
+const generatedTest = `package goffsets
+
+import "testing"
+
+func TestGenerated(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		find          func(arch, libVersion string) (uint64, bool)
+		arch, version string
+		offset        uint64
+		ok            bool
+	}{
+		{"Method", NetHTTPRequestMethodArch, "arm64", "1.12.0", 0, false},
+		// versions that offsets.Track.Find can't parse, or whose segments can't be packed
+		{"Method", NetHTTPRequestMethodArch, DefaultArch, "1.65536.0", 0, false},
+		{"Method", NetHTTPRequestMethodArch, DefaultArch, "devel", 0, false},
+		{"Method", NetHTTPRequestMethodArch, DefaultArch, "", 0, false},
+%s	} {
+		if offset, ok := c.find(c.arch, c.version); offset != c.offset || ok != c.ok {
+			t.Errorf("%%s %%s %%q: got %%d, %%v", c.name, c.arch, c.version, offset, ok)
+		}
+	}
+	if allocs := testing.AllocsPerRun(100, func() { NetHTTPRequestProto("1.22.0-rc.1") }); allocs != 0 {
+		t.Errorf("%%v allocations", allocs)
+	}
+}
+`
+
+// runTrack is testTrack with a field whose offset changed in a prerelease
+func runTrack() *offsets.Track {
+	track := testTrack()
+	track.Data["net/http.Request"]["Proto"] = offsets.Field{Offsets: []offsets.Versioned{
+		{Offset: 16, Since: "1.12.0"}, {Offset: 24, Since: "1.22.0-rc.2"}, {Offset: 32, Since: "1.22.0"},
+	}}
+	return track
+}
+
+func TestGo_Run(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs the generated code")
+	}
+	track := runTrack()
+	cases := strings.Builder{}
+	for _, f := range []struct{ name, fn string }{
+		{"Method", "NetHTTPRequestMethodArch"}, {"URL->Path", "NetHTTPRequestURLPathArch"}, {"Proto", "NetHTTPRequestProtoArch"},
+	} {
+		for _, arch := range []string{offsets.DefaultArch, "386"} {
+			for _, v := range []string{
+				"1.11.0", "1.11.5", "1.12.0", "1.12rc1", "1.12.0-rc.1", "v1.21.3", "1.22.0-beta.1", "1.22.0-rc.1",
+				"1.22.0-rc.2", "1.22.0-rc.10", "1.22rc3", "1.22.0", "1.22.0 X:boringcrypto", "1.22.0+meta",
+			} {
+				offset, ok := track.FindArch(arch, "net/http.Request", f.name, v)
+				fmt.Fprintf(&cases, "\t\t{%q, %s, %q, %q, %d, %v},\n", f.name, f.fn, arch, v, offset, ok)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	out := bytes.Buffer{}
+	require.NoError(t, Go(&out, track, "goffsets"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "offsets.go"), out.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "offsets_test.go"),
+		[]byte(fmt.Sprintf(generatedTest, cases.String())), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module goffsets\n\ngo 1.20\n"), 0o644))
+
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+}
+
+func TestGo_Errors(t *testing.T) {
+	assert.Error(t, Go(&bytes.Buffer{}, testTrack(), "not-a-package"))
+
+	track := testTrack()
+	track.Data["net/http.Request"]["URL.Path"] = offsets.Field{}
+	assert.ErrorContains(t, Go(&bytes.Buffer{}, track, "goffsets"), "NetHTTPRequestURLPath")
+
+	// versions that can't be packed
+	track = testTrack()
+	track.Data["net/http.Request"]["Method"] = offsets.Field{Offsets: []offsets.Versioned{{Since: "1.65536.0"}}}
+	assert.ErrorContains(t, Go(&bytes.Buffer{}, track, "goffsets"), "version 1.65536.0 can't be packed")
+}
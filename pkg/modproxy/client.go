@@ -0,0 +1,284 @@
+// Package modproxy implements a client for the Go module proxy protocol
+// (https://go.dev/ref/mod#goproxy-protocol), which is used to discover the versions
+// of a module and to read their go.mod files without invoking the go command.
+package modproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb"
+)
+
+const (
+	defaultProxy  = "https://proxy.golang.org,direct"
+	directProxy   = "direct"
+	disabledProxy = "off"
+)
+
+// ErrDirect is returned when a module must be fetched directly from its version control
+// repository, because it matches GOPRIVATE or GONOPROXY, or GOPROXY reached "direct".
+// Direct fetching is not supported by this client, so the go command should be used instead.
+var ErrDirect = errors.New("module must be fetched directly from its repository")
+
+// ErrDisabled is returned when GOPROXY reached "off"
+var ErrDisabled = errors.New("module lookup disabled by GOPROXY=off")
+
+// ErrVerification is returned when the go.mod file of the latest version of a module, which lists
+// its retracted versions, can't be verified against the checksum database
+var ErrVerification = errors.New("go.mod can't be verified against the checksum database")
+
+// errNotFound is returned by a proxy that does not know a module or version. The
+// next proxy in the GOPROXY list is then queried
+var errNotFound = errors.New("not found")
+
+// Config of the client, following the semantics of the go command environment variables
+type Config struct {
+	// Proxy is a GOPROXY list of proxy URLs, separated by commas or pipes. A comma only
+	// falls back to the next proxy if the module or version is not found. A pipe falls back
+	// after any error. The "direct" and "off" keywords are accepted.
+	Proxy string
+	// Private is a GOPRIVATE list of module path prefix patterns
+	Private string
+	// NoProxy is a GONOPROXY list of module path prefix patterns that are not fetched from any
+	// proxy. Defaults to Private
+	NoProxy string
+	// NoSumDB is a GONOSUMDB list of module path prefix patterns whose go.mod files are not verified
+	// against the checksum database. Defaults to Private
+	NoSumDB string
+	// SumDB is the GOSUMDB checksum database: its public key (name+hash+key) or the name of a known
+	// database, optionally followed by the URL to connect to it. "off" disables the verification
+	// of the go.mod files
+	SumDB string
+}
+
+// ConfigFromEnv returns the configuration from the GOPROXY, GOPRIVATE, GONOPROXY, GONOSUMDB
+// and GOSUMDB environment variables
+func ConfigFromEnv() Config {
+	return Config{
+		Proxy:   os.Getenv("GOPROXY"),
+		Private: os.Getenv("GOPRIVATE"),
+		NoProxy: os.Getenv("GONOPROXY"),
+		NoSumDB: os.Getenv("GONOSUMDB"),
+		SumDB:   os.Getenv("GOSUMDB"),
+	}
+}
+
+type proxy struct {
+	url string
+	// fallbackOnError is true if the next proxy is queried after any error
+	fallbackOnError bool
+}
+
+// Client of the module proxy protocol
+type Client struct {
+	proxies []proxy
+	noProxy string
+	noSumDB string
+	// sumDBName is the name of the checksum database, or empty if verification is disabled
+	sumDBName string
+	// sumDBKey is the public key that verifies the signed tree heads of the checksum database
+	sumDBKey string
+	// sumDBURL is the URL of the checksum database, if it is explicitly provided
+	sumDBURL  string
+	sumDBOnce sync.Once
+	sumDBBase string
+	sumDB     *sumdb.Client
+	http      *http.Client
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	c := &Client{
+		noProxy: cfg.NoProxy,
+		noSumDB: cfg.NoSumDB,
+		http:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	if c.noProxy == "" {
+		c.noProxy = cfg.Private
+	}
+	if c.noSumDB == "" {
+		c.noSumDB = cfg.Private
+	}
+
+	list := cfg.Proxy
+	if list == "" {
+		list = defaultProxy
+	}
+	for list != "" {
+		var p proxy
+		if i := strings.IndexAny(list, ",|"); i >= 0 {
+			p = proxy{url: list[:i], fallbackOnError: list[i] == '|'}
+			list = list[i+1:]
+		} else {
+			p, list = proxy{url: list}, ""
+		}
+		p.url = strings.TrimSuffix(strings.TrimSpace(p.url), "/")
+		if p.url == "" {
+			continue
+		}
+		if p.url != directProxy && p.url != disabledProxy &&
+			!strings.HasPrefix(p.url, "https://") && !strings.HasPrefix(p.url, "http://") &&
+			!strings.HasPrefix(p.url, "file://") {
+			return nil, fmt.Errorf("invalid GOPROXY URL: %q", p.url)
+		}
+		c.proxies = append(c.proxies, p)
+	}
+	if len(c.proxies) == 0 {
+		return nil, errors.New("GOPROXY list is empty")
+	}
+
+	if err := c.initSumDB(cfg.SumDB); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Versions returns the tagged versions of a module, sorted semantically and excluding the
+// versions that are retracted by the latest version of the module, as `go list -m -versions` does.
+// It returns an ErrVerification error if the go.mod of the latest version can't be verified
+func (c *Client) Versions(modPath string) ([]string, error) {
+	list, err := c.fetch(modPath, "list")
+	if err != nil {
+		return nil, err
+	}
+	var vers []string
+	for _, line := range strings.Split(string(list), "\n") {
+		// each line might be followed by other metadata, separated by spaces
+		fields := strings.Fields(line)
+		if len(fields) > 0 && semver.IsValid(fields[0]) && !module.IsPseudoVersion(fields[0]) {
+			vers = append(vers, fields[0])
+		}
+	}
+	semver.Sort(vers)
+	if len(vers) == 0 {
+		return vers, nil
+	}
+	return c.withoutRetracted(modPath, vers)
+}
+
+// withoutRetracted removes the versions that are retracted in the go.mod of the latest version
+func (c *Client) withoutRetracted(modPath string, vers []string) ([]string, error) {
+	latest := vers[len(vers)-1]
+	for i := len(vers) - 1; i >= 0; i-- {
+		if semver.Prerelease(vers[i]) == "" {
+			latest = vers[i]
+			break
+		}
+	}
+	goMod, err := c.fetchVersion(modPath, latest, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyGoMod(modPath, latest, goMod); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVerification, err)
+	}
+	mf, err := modfile.ParseLax("go.mod", goMod, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parsing go.mod of %s@%s: %w", modPath, latest, err)
+	}
+	if len(mf.Retract) == 0 {
+		return vers, nil
+	}
+	var result []string
+	for _, v := range vers {
+		retracted := false
+		for _, r := range mf.Retract {
+			if semver.Compare(r.Low, v) <= 0 && semver.Compare(v, r.High) <= 0 {
+				retracted = true
+				break
+			}
+		}
+		if !retracted {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// GoMod returns the go.mod file of a module version
+func (c *Client) GoMod(modPath, version string) ([]byte, error) {
+	data, err := c.fetchVersion(modPath, version, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyGoMod(modPath, version, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *Client) fetchVersion(modPath, version, suffix string) ([]byte, error) {
+	escaped, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetch(modPath, escaped+suffix)
+}
+
+// fetch queries the proxies of the GOPROXY list for a file of the /@v/ endpoint of a module
+func (c *Client) fetch(modPath, file string) ([]byte, error) {
+	if module.MatchPrefixPatterns(c.noProxy, modPath) {
+		return nil, fmt.Errorf("%s: %w", modPath, ErrDirect)
+	}
+	escaped, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, p := range c.proxies {
+		switch p.url {
+		case directProxy:
+			return nil, fmt.Errorf("%s: %w", modPath, ErrDirect)
+		case disabledProxy:
+			return nil, fmt.Errorf("%s: %w", modPath, ErrDisabled)
+		}
+		data, err := c.get(p.url + "/" + escaped + "/@v/" + file)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = fmt.Errorf("%s/@v/%s: %w", modPath, file, err)
+		if !p.fallbackOnError && !errors.Is(err, errNotFound) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// get reads the contents of an HTTP(S) or file URL
+func (c *Client) get(rawURL string) ([]byte, error) {
+	if strings.HasPrefix(rawURL, "file://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.FromSlash(u.Path))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errNotFound
+		}
+		return data, err
+	}
+	resp, err := c.http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound, http.StatusGone:
+		return nil, errNotFound
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+}
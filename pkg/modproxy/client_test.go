@@ -0,0 +1,170 @@
+package modproxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+const testModule = "example.com/Org/lib"
+
+// writeProxy creates a file proxy with the testModule, whose latest version retracts v1.1.0.
+// It returns the go.sum lines of each version (key: module@version), with the hashes of its go.mod files
+func writeProxy(t *testing.T) (proxyDir string, sums map[string]string) {
+	proxyDir, sums = t.TempDir(), map[string]string{}
+	// upper case letters are escaped with an exclamation mark
+	vDir := filepath.Join(proxyDir, "example.com", "!org", "lib", "@v")
+	require.NoError(t, os.MkdirAll(vDir, 0o755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(vDir, name), []byte(content), 0o644))
+	}
+	write("list", "v1.1.0\nv1.0.0\nv1.2.0 2023-01-01T00:00:00Z\nv0.0.0-20230101000000-abcdefabcdef\nv1.3.0-rc.1\n")
+	goMods := map[string]string{
+		"v1.0.0":      "module example.com/Org/lib\n",
+		"v1.1.0":      "module example.com/Org/lib\n",
+		"v1.2.0":      "module example.com/Org/lib\n\nretract v1.1.0\n",
+		"v1.3.0-rc.1": "module example.com/Org/lib\n",
+	}
+	for v, goMod := range goMods {
+		write(v+".mod", goMod)
+		hash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewBufferString(goMod)), nil
+		})
+		require.NoError(t, err)
+		sums[testModule+"@"+v] = testModule + " " + v + "/go.mod " + hash + "\n"
+	}
+	return proxyDir, sums
+}
+
+// serveSumDB serves a checksum database signed with a new key, whose records are the go.sum lines
+// of each module version. The lines of a version must be set before it is looked up for the first
+// time. It returns the GOSUMDB value to connect to the database
+func serveSumDB(t *testing.T, sums map[string]string) string {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		lines, ok := sums[path+"@"+vers]
+		if !ok {
+			return nil, fmt.Errorf("%s@%s: %w", path, vers, os.ErrNotExist)
+		}
+		return []byte(lines), nil
+	})))
+	t.Cleanup(srv.Close)
+	return vkey + " " + srv.URL
+}
+
+func TestVersions(t *testing.T) {
+	proxyDir, sums := writeProxy(t)
+	c, err := NewClient(Config{
+		Proxy: "file://" + filepath.ToSlash(proxyDir),
+		SumDB: serveSumDB(t, sums),
+	})
+	require.NoError(t, err)
+
+	vers, err := c.Versions(testModule)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.2.0", "v1.3.0-rc.1"}, vers)
+}
+
+func TestVersions_Fallback(t *testing.T) {
+	proxyDir, _ := writeProxy(t)
+	emptyDir := t.TempDir()
+
+	// a comma falls back to the next proxy when the module is not found
+	c, err := NewClient(Config{
+		Proxy: "file://" + filepath.ToSlash(emptyDir) + ",file://" + filepath.ToSlash(proxyDir),
+		SumDB: "off",
+	})
+	require.NoError(t, err)
+	vers, err := c.Versions(testModule)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.2.0", "v1.3.0-rc.1"}, vers)
+
+	// direct fetching is not supported
+	c, err = NewClient(Config{Proxy: "file://" + filepath.ToSlash(emptyDir) + ",direct", SumDB: "off"})
+	require.NoError(t, err)
+	_, err = c.Versions(testModule)
+	assert.ErrorIs(t, err, ErrDirect)
+
+	// private modules are not fetched from the proxies
+	c, err = NewClient(Config{Proxy: "file://" + filepath.ToSlash(proxyDir), Private: "example.com/Org"})
+	require.NoError(t, err)
+	_, err = c.Versions(testModule)
+	assert.ErrorIs(t, err, ErrDirect)
+
+	c, err = NewClient(Config{Proxy: "off"})
+	require.NoError(t, err)
+	_, err = c.Versions(testModule)
+	assert.ErrorIs(t, err, ErrDisabled)
+}
+
+func TestGoMod_SumDB(t *testing.T) {
+	proxyDir, sums := writeProxy(t)
+	delete(sums, testModule+"@v1.0.0")
+	sums[testModule+"@v1.3.0-rc.1"] = testModule + " v1.3.0-rc.1/go.mod h1:wrong=\n"
+	gosumdb := serveSumDB(t, sums)
+
+	c, err := NewClient(Config{Proxy: "file://" + filepath.ToSlash(proxyDir), SumDB: gosumdb})
+	require.NoError(t, err)
+	goMod, err := c.GoMod(testModule, "v1.2.0")
+	require.NoError(t, err)
+	assert.Contains(t, string(goMod), "retract v1.1.0")
+
+	// the checksum database does not contain the module version
+	_, err = c.GoMod(testModule, "v1.0.0")
+	assert.ErrorContains(t, err, "checksum database")
+	_, err = c.GoMod(testModule, "v1.3.0-rc.1")
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	// modules in GONOSUMDB are not verified
+	c, err = NewClient(Config{Proxy: "file://" + filepath.ToSlash(proxyDir), SumDB: gosumdb, NoSumDB: "example.com"})
+	require.NoError(t, err)
+	_, err = c.GoMod(testModule, "v1.3.0-rc.1")
+	require.NoError(t, err)
+
+	// the tree heads that are not signed by the key of GOSUMDB are rejected
+	_, otherKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+	_, sumDBURL, _ := strings.Cut(gosumdb, " ")
+	c, err = NewClient(Config{Proxy: "file://" + filepath.ToSlash(proxyDir), SumDB: otherKey + " " + sumDBURL})
+	require.NoError(t, err)
+	_, err = c.GoMod(testModule, "v1.2.0")
+	assert.ErrorContains(t, err, "no verifiable signatures")
+	// the versions can still be listed with the go command
+	_, err = c.Versions(testModule)
+	assert.ErrorIs(t, err, ErrVerification)
+}
+
+func TestNewClient_SumDB(t *testing.T) {
+	c, err := NewClient(Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "sum.golang.org", c.sumDBName)
+	assert.Equal(t, knownSumDBs["sum.golang.org"], c.sumDBKey)
+
+	c, err = NewClient(Config{SumDB: "sum.golang.google.cn"})
+	require.NoError(t, err)
+	assert.Equal(t, "sum.golang.org", c.sumDBName)
+	assert.Equal(t, "https://sum.golang.google.cn", c.sumDBURL)
+
+	c, err = NewClient(Config{SumDB: "off"})
+	require.NoError(t, err)
+	assert.True(t, c.skipVerify(testModule))
+
+	// the key of unknown databases must be provided
+	_, err = NewClient(Config{SumDB: "sum.example.com"})
+	assert.Error(t, err)
+	_, err = NewClient(Config{SumDB: "sum.golang.org https://a https://b"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package modproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// knownSumDBs key: name of a checksum database, value: its public key
+var knownSumDBs = map[string]string{
+	"sum.golang.org": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+}
+
+// initSumDB parses the GOSUMDB value as the go command does: the public key of the checksum database,
+// or the name of a known database, optionally followed by the URL to connect to it
+func (c *Client) initSumDB(gosumdb string) error {
+	switch gosumdb {
+	case "":
+		gosumdb = "sum.golang.org"
+	case disabledProxy:
+		return nil
+	case "sum.golang.google.cn":
+		// alias of sum.golang.org that is reachable inside mainland China
+		gosumdb = "sum.golang.org https://sum.golang.google.cn"
+	}
+	fields := strings.Fields(gosumdb)
+	if len(fields) > 2 {
+		return errors.New("invalid GOSUMDB: too many fields")
+	}
+	c.sumDBKey = fields[0]
+	if key, ok := knownSumDBs[c.sumDBKey]; ok {
+		c.sumDBKey = key
+	}
+	verifier, err := note.NewVerifier(c.sumDBKey)
+	if err != nil {
+		return fmt.Errorf("invalid GOSUMDB: %w", err)
+	}
+	c.sumDBName = verifier.Name()
+	if len(fields) > 1 {
+		c.sumDBURL = strings.TrimSuffix(fields[1], "/")
+	}
+	c.sumDB = sumdb.NewClient(&sumDBOps{client: c, config: map[string][]byte{}, cache: map[string][]byte{}})
+	return nil
+}
+
+// verifyGoMod checks the hash of a go.mod file against the checksum database
+func (c *Client) verifyGoMod(modPath, version string, goMod []byte) error {
+	if c.skipVerify(modPath) {
+		return nil
+	}
+	hash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.verify(modPath, version+"/go.mod", hash)
+}
+
+func (c *Client) skipVerify(modPath string) bool {
+	return c.sumDB == nil || module.MatchPrefixPatterns(c.noSumDB, modPath)
+}
+
+// sumDBURLBase returns the base URL of the checksum database. As the go command does, if the URL is
+// not explicitly provided, the database is accessed through the first proxy that supports it
+func (c *Client) sumDBURLBase() string {
+	c.sumDBOnce.Do(func() {
+		if c.sumDBURL != "" {
+			c.sumDBBase = c.sumDBURL
+			return
+		}
+		c.sumDBBase = "https://" + c.sumDBName
+		for _, p := range c.proxies {
+			if p.url == directProxy || p.url == disabledProxy {
+				return
+			}
+			base := p.url + "/sumdb/" + c.sumDBName
+			if _, err := c.get(base + "/supported"); err == nil {
+				c.sumDBBase = base
+				return
+			}
+		}
+	})
+	return c.sumDBBase
+}
+
+// verify looks up a module version in the checksum database and compares the go.sum hash of
+// the provided entry, which is either the version or the version followed by /go.mod.
+// The lookup is verified against the signed tree head of the checksum database, so a proxy
+// that serves both the module and the database can't forge the hashes
+func (c *Client) verify(modPath, entry, hash string) error {
+	lines, err := c.sumDB.Lookup(modPath, entry)
+	if err != nil {
+		return fmt.Errorf("looking up %s %s in the checksum database: %w", modPath, entry, err)
+	}
+	prefix := modPath + " " + entry + " "
+	for _, line := range lines {
+		if expected, ok := strings.CutPrefix(line, prefix); ok {
+			if expected != hash {
+				return fmt.Errorf("checksum mismatch for %s %s: downloaded %s, checksum database %s",
+					modPath, entry, hash, expected)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s not found in the checksum database", modPath, entry)
+}
+
+// sumDBOps implements the sumdb.ClientOps. The latest signed tree head and the downloaded
+// tiles are only kept in memory during the life of the client
+type sumDBOps struct {
+	client *Client
+	mu     sync.Mutex
+	config map[string][]byte
+	cache  map[string][]byte
+}
+
+func (o *sumDBOps) ReadRemote(path string) ([]byte, error) {
+	return o.client.get(o.client.sumDBURLBase() + path)
+}
+
+func (o *sumDBOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.client.sumDBKey), nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// an empty latest tree head makes the client start from scratch
+	return o.config[file], nil
+}
+
+func (o *sumDBOps) WriteConfig(file string, old, new []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *sumDBOps) ReadCache(file string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	data, ok := o.cache[file]
+	if !ok {
+		return nil, errNotFound
+	}
+	return data, nil
+}
+
+func (o *sumDBOps) WriteCache(file string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cache[file] = data
+}
+
+func (o *sumDBOps) Log(string) {}
+
+// SecurityError logs the message. The lookup that caused it returns sumdb.ErrSecurity
+func (o *sumDBOps) SecurityError(msg string) {
+	log.Print(msg)
+}
@@ -0,0 +1,331 @@
+package offsets
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// TrackDiff contains the differences between two versions of an offsets file
+type TrackDiff struct {
+	Structs []StructDiff `json:"structs"`
+	// Changed is true if the offsets of any version that was tracked in the old file changed
+	Changed bool `json:"changed"`
+}
+
+// StructDiff contains the differences of a struct that was added, removed or modified
+type StructDiff struct {
+	Struct  string      `json:"struct"`
+	Added   bool        `json:"added,omitempty"`
+	Removed bool        `json:"removed,omitempty"`
+	Fields  []FieldDiff `json:"fields,omitempty"`
+	// ChangedSizes contains the versions that were tracked in both files, but whose struct size changed
+	ChangedSizes []ChangedSize `json:"changed_sizes,omitempty"`
+}
+
+// FieldDiff contains the differences of a field that was added, removed or modified
+type FieldDiff struct {
+	Field   string `json:"field"`
+	Added   bool   `json:"added,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+	// NewOffsets are the offsets of the new file whose "since" entry was not in the old file
+	NewOffsets []Versioned `json:"new_offsets,omitempty"`
+	// OldVersions and NewVersions are the tracked versions ranges, if they changed
+	OldVersions *VersionInfo `json:"old_versions,omitempty"`
+	NewVersions *VersionInfo `json:"new_versions,omitempty"`
+	// Changed contains the versions that were tracked in both files, but whose offsets changed
+	Changed []ChangedVersion `json:"changed,omitempty"`
+}
+
+// ChangedVersion is a version whose offset is different in the old and the new files
+type ChangedVersion struct {
+	Version string    `json:"version"`
+	Arch    string    `json:"arch,omitempty"`
+	Old     Versioned `json:"old"`
+	New     Versioned `json:"new"`
+}
+
+// ChangedSize is a version whose struct size is different in the old and the new files
+type ChangedSize struct {
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+	Old     uint64 `json:"old"`
+	New     uint64 `json:"new"`
+}
+
+// Diff returns the differences between an old and a new version of an offsets file, sorted by struct
+// and field name. The offsets of a version that was tracked in both files are considered as changed
+// if the field offset, its path or its absence are different, or if both files contain the size or the
+// type of the field and they are different. The struct sizes of the versions that were tracked in both
+// files are also compared.
+func Diff(oldTrack, newTrack *Track) *TrackDiff {
+	diff := &TrackDiff{Structs: []StructDiff{}}
+	for _, structName := range unionKeys(oldTrack.Data, newTrack.Data) {
+		oldStruct, inOld := oldTrack.Data[structName]
+		newStruct, inNew := newTrack.Data[structName]
+		sd := StructDiff{Struct: structName, Added: !inOld, Removed: !inNew}
+		for _, fieldName := range unionKeys(oldStruct, newStruct) {
+			oldField, inOld := oldStruct[fieldName]
+			newField, inNew := newStruct[fieldName]
+			var fd FieldDiff
+			switch {
+			case !inOld:
+				fd = FieldDiff{Field: fieldName, Added: true, NewOffsets: newField.Offsets,
+					NewVersions: &newField.Versions}
+			case !inNew:
+				fd = FieldDiff{Field: fieldName, Removed: true, OldVersions: &oldField.Versions}
+			default:
+				fd = diffField(fieldName, &oldField, &newField)
+				if len(fd.NewOffsets) == 0 && fd.NewVersions == nil && len(fd.Changed) == 0 {
+					continue
+				}
+			}
+			diff.Changed = diff.Changed || len(fd.Changed) > 0
+			sd.Fields = append(sd.Fields, fd)
+		}
+		if inOld && inNew {
+			sd.ChangedSizes = diffSizes(oldTrack, newTrack, structName)
+			diff.Changed = diff.Changed || len(sd.ChangedSizes) > 0
+		}
+		if sd.Added || sd.Removed || len(sd.Fields) > 0 || len(sd.ChangedSizes) > 0 {
+			diff.Structs = append(diff.Structs, sd)
+		}
+	}
+	return diff
+}
+
+func diffField(fieldName string, oldField, newField *Field) FieldDiff {
+	fd := FieldDiff{Field: fieldName}
+	if oldField.Versions != newField.Versions {
+		fd.OldVersions, fd.NewVersions = &oldField.Versions, &newField.Versions
+	}
+	oldSince := map[string]bool{}
+	for _, od := range oldField.Offsets {
+		oldSince[ArchOrDefault(od.Arch)+"@"+od.Since] = true
+	}
+	for _, od := range newField.Offsets {
+		if !oldSince[ArchOrDefault(od.Arch)+"@"+od.Since] {
+			fd.NewOffsets = append(fd.NewOffsets, od)
+		}
+	}
+
+	// the offsets can only change at the versions of the "since" entries of any of both files, and at
+	// the oldest version that both files track, as the entries might start before it
+	checked := map[string]bool{}
+	points := append(append([]Versioned{}, oldField.Offsets...), newField.Offsets...)
+	for _, od := range append(points, overlapStarts(oldField, newField)...) {
+		arch := ArchOrDefault(od.Arch)
+		if checked[arch+"@"+od.Since] || !tracked(oldField, arch, od.Since) || !tracked(newField, arch, od.Since) {
+			continue
+		}
+		checked[arch+"@"+od.Since] = true
+		oldOD, okOld := oldField.Get(arch, od.Since)
+		newOD, okNew := newField.Get(arch, od.Since)
+		if okOld && okNew && !sameLocation(oldOD, newOD) {
+			fd.Changed = append(fd.Changed, ChangedVersion{Version: od.Since, Arch: od.Arch, Old: *oldOD, New: *newOD})
+		}
+	}
+	sort.Slice(fd.Changed, func(i, j int) bool {
+		if fd.Changed[i].Arch != fd.Changed[j].Arch {
+			return fd.Changed[i].Arch < fd.Changed[j].Arch
+		}
+		return versions.MustParse(fd.Changed[i].Version).LessThan(versions.MustParse(fd.Changed[j].Version))
+	})
+	return fd
+}
+
+// diffSizes returns the versions whose struct size changed, among the versions of the struct sizes
+// of both files where any field of the struct was tracked in both files
+func diffSizes(oldTrack, newTrack *Track, structName string) []ChangedSize {
+	var changed []ChangedSize
+	checked := map[string]bool{}
+	sizes := append(append([]VersionedSize{}, oldTrack.Structs[structName].Sizes...), newTrack.Structs[structName].Sizes...)
+	for fieldName, oldField := range oldTrack.Data[structName] {
+		if newField, ok := newTrack.Data[structName][fieldName]; ok {
+			for _, od := range overlapStarts(&oldField, &newField) {
+				sizes = append(sizes, VersionedSize{Since: od.Since, Arch: od.Arch})
+			}
+		}
+	}
+	for _, vs := range sizes {
+		arch := ArchOrDefault(vs.Arch)
+		if checked[arch+"@"+vs.Since] || !structTracked(oldTrack.Data[structName], arch, vs.Since) ||
+			!structTracked(newTrack.Data[structName], arch, vs.Since) {
+			continue
+		}
+		checked[arch+"@"+vs.Since] = true
+		oldSize, okOld := oldTrack.StructSize(arch, structName, vs.Since)
+		newSize, okNew := newTrack.StructSize(arch, structName, vs.Since)
+		if okOld && okNew && oldSize != newSize {
+			changed = append(changed, ChangedSize{Version: vs.Since, Arch: vs.Arch, Old: oldSize, New: newSize})
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		if changed[i].Arch != changed[j].Arch {
+			return changed[i].Arch < changed[j].Arch
+		}
+		return versions.MustParse(changed[i].Version).LessThan(versions.MustParse(changed[j].Version))
+	})
+	return changed
+}
+
+// overlapStarts returns, for each architecture of both fields, an entry whose "since" version is the
+// oldest version that both fields track
+func overlapStarts(oldField, newField *Field) []Versioned {
+	var starts []Versioned
+	seen := map[string]bool{}
+	for _, od := range append(append([]Versioned{}, oldField.Offsets...), newField.Offsets...) {
+		arch := ArchOrDefault(od.Arch)
+		if seen[arch] {
+			continue
+		}
+		seen[arch] = true
+		oldVI, okOld := oldField.VersionsArch(arch)
+		newVI, okNew := newField.VersionsArch(arch)
+		if !okOld || !okNew {
+			continue
+		}
+		start := oldVI.Oldest
+		if start == "" || (newVI.Oldest != "" && versions.MustParse(start).LessThan(versions.MustParse(newVI.Oldest))) {
+			start = newVI.Oldest
+		}
+		if start != "" {
+			starts = append(starts, Versioned{Since: start, Arch: od.Arch})
+		}
+	}
+	return starts
+}
+
+// structTracked returns whether a version is within the tracked versions range of any field of a struct
+func structTracked(strct Struct, arch, v string) bool {
+	for _, field := range strct {
+		if tracked(&field, arch, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// tracked returns whether a version is within the tracked versions range of a field in an architecture.
+// Files generated before the ranges were tracked are assumed to track all the versions
+func tracked(field *Field, arch, v string) bool {
+	vi, ok := field.VersionsArch(arch)
+	if !ok {
+		return false
+	}
+	if vi.Oldest == "" || vi.Newest == "" {
+		return true
+	}
+	return versions.Between(v, vi.Oldest, vi.Newest)
+}
+
+// sameLocation returns whether both entries locate the field at the same place. The field sizes
+// and types are only compared if both entries contain them
+func sameLocation(a, b *Versioned) bool {
+	if a.Absent != b.Absent || a.Offset != b.Offset || len(a.Path) != len(b.Path) {
+		return false
+	}
+	for i := range a.Path {
+		if a.Path[i] != b.Path[i] {
+			return false
+		}
+	}
+	return (a.Size == 0 || b.Size == 0 || a.Size == b.Size) &&
+		(a.Type == "" || b.Type == "" || a.Type == b.Type)
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteMarkdown writes a human-readable changelog of the differences, to be used in pull request descriptions
+func (d *TrackDiff) WriteMarkdown(w io.Writer) error {
+	md := strings.Builder{}
+	md.WriteString("## Offsets changes\n\n")
+	if len(d.Structs) == 0 {
+		md.WriteString("No changes.\n")
+	}
+	if d.Changed {
+		md.WriteString("> **Warning**: the offsets of some versions that were already tracked have changed.\n\n")
+	}
+	for _, sd := range d.Structs {
+		fmt.Fprintf(&md, "### `%s`", sd.Struct)
+		switch {
+		case sd.Added:
+			md.WriteString(" (added)")
+		case sd.Removed:
+			md.WriteString(" (removed)")
+		}
+		md.WriteString("\n\n")
+		for _, fd := range sd.Fields {
+			fmt.Fprintf(&md, "* `%s`", fd.Field)
+			switch {
+			case fd.Added:
+				md.WriteString(" (added)")
+			case fd.Removed:
+				md.WriteString(" (removed)")
+			}
+			if fd.NewVersions != nil {
+				if fd.OldVersions != nil {
+					fmt.Fprintf(&md, ": versions %s → %s", versionsRange(fd.OldVersions), versionsRange(fd.NewVersions))
+				} else {
+					fmt.Fprintf(&md, ": versions %s", versionsRange(fd.NewVersions))
+				}
+			} else if fd.Removed {
+				fmt.Fprintf(&md, ": versions %s", versionsRange(fd.OldVersions))
+			}
+			md.WriteString("\n")
+			for _, od := range fd.NewOffsets {
+				fmt.Fprintf(&md, "  * since `%s`%s: %s\n", od.Since, archSuffix(od.Arch), describe(&od))
+			}
+			for _, c := range fd.Changed {
+				fmt.Fprintf(&md, "  * **changed** `%s`%s: %s → %s\n", c.Version, archSuffix(c.Arch), describe(&c.Old), describe(&c.New))
+			}
+		}
+		for _, c := range sd.ChangedSizes {
+			fmt.Fprintf(&md, "* **struct size changed** `%s`%s: %d → %d\n", c.Version, archSuffix(c.Arch), c.Old, c.New)
+		}
+		md.WriteString("\n")
+	}
+	_, err := io.WriteString(w, md.String())
+	return err
+}
+
+func versionsRange(v *VersionInfo) string {
+	return fmt.Sprintf("`%s`..`%s`", v.Oldest, v.Newest)
+}
+
+func archSuffix(arch string) string {
+	if arch == "" {
+		return ""
+	}
+	return " (" + arch + ")"
+}
+
+// describe returns a short description of the offset of a field
+func describe(od *Versioned) string {
+	if od.Absent {
+		return "absent"
+	}
+	desc := fmt.Sprintf("offset %d", od.Offset)
+	if od.Type != "" {
+		desc += fmt.Sprintf(", type `%s`", od.Type)
+	}
+	if od.Size != 0 {
+		desc += fmt.Sprintf(", size %d", od.Size)
+	}
+	return desc
+}
@@ -0,0 +1,156 @@
+package offsets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const diffOld = `{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.20.0" },
+				"offsets": [ { "offset": 0, "since": "1.12.0", "type": "string" } ]
+			},
+			"ctx": {
+				"versions": { "oldest": "1.12.0", "newest": "1.20.0" },
+				"offsets": [ { "offset": 232, "since": "1.12.0" }, { "offset": 240, "since": "1.18.0" } ]
+			}
+		},
+		"runtime.g": {
+			"goid": {
+				"versions": { "oldest": "1.12.0", "newest": "1.20.0" },
+				"offsets": [ { "offset": 152, "since": "1.12.0" } ]
+			}
+		}
+	}
+}`
+
+const diffNew = `{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"offsets": [ { "offset": 0, "since": "1.12.0", "type": "string" }, { "offset": 8, "since": "1.21.0" } ]
+			},
+			"ctx": {
+				"versions": { "oldest": "1.12.0", "newest": "1.20.0" },
+				"offsets": [ { "offset": 232, "since": "1.12.0" }, { "offset": 248, "since": "1.19.0" } ]
+			},
+			"Pattern": {
+				"versions": { "oldest": "1.21.0", "newest": "1.21.0" },
+				"offsets": [ { "since": "1.21.0", "absent": true } ]
+			}
+		}
+	}
+}`
+
+func TestDiff(t *testing.T) {
+	oldTrack, err := Read(bytes.NewBufferString(diffOld))
+	require.NoError(t, err)
+	newTrack, err := Read(bytes.NewBufferString(diffNew))
+	require.NoError(t, err)
+
+	d := Diff(oldTrack, newTrack)
+	assert.True(t, d.Changed)
+	require.Len(t, d.Structs, 2)
+
+	req := d.Structs[0]
+	assert.Equal(t, "net/http.Request", req.Struct)
+	require.Len(t, req.Fields, 3)
+	assert.Equal(t, "Method", req.Fields[0].Field)
+	assert.Equal(t, []Versioned{{Offset: 8, Since: "1.21.0"}}, req.Fields[0].NewOffsets)
+	assert.Equal(t, &VersionInfo{Oldest: "1.12.0", Newest: "1.21.0"}, req.Fields[0].NewVersions)
+	assert.Empty(t, req.Fields[0].Changed)
+	assert.Equal(t, FieldDiff{Field: "Pattern", Added: true,
+		NewOffsets:  []Versioned{{Since: "1.21.0", Absent: true}},
+		NewVersions: &VersionInfo{Oldest: "1.21.0", Newest: "1.21.0"},
+	}, req.Fields[1])
+	// the ctx offset of the versions 1.18.x changed from 240 to 232, and from 240 to 248 since 1.19.0
+	ctx := req.Fields[2]
+	assert.Equal(t, "ctx", ctx.Field)
+	require.Len(t, ctx.Changed, 2)
+	assert.Equal(t, "1.18.0", ctx.Changed[0].Version)
+	assert.EqualValues(t, 240, ctx.Changed[0].Old.Offset)
+	assert.EqualValues(t, 232, ctx.Changed[0].New.Offset)
+	assert.Equal(t, "1.19.0", ctx.Changed[1].Version)
+	assert.EqualValues(t, 248, ctx.Changed[1].New.Offset)
+
+	assert.Equal(t, StructDiff{Struct: "runtime.g", Removed: true, Fields: []FieldDiff{{
+		Field: "goid", Removed: true, OldVersions: &VersionInfo{Oldest: "1.12.0", Newest: "1.20.0"},
+	}}}, d.Structs[1])
+
+	md := strings.Builder{}
+	require.NoError(t, d.WriteMarkdown(&md))
+	assert.Contains(t, md.String(), "* `Method`: versions `1.12.0`..`1.20.0` → `1.12.0`..`1.21.0`\n  * since `1.21.0`: offset 8\n")
+	assert.Contains(t, md.String(), "  * **changed** `1.18.0`: offset 240 → offset 232\n")
+	assert.Contains(t, md.String(), "### `runtime.g` (removed)")
+}
+
+func TestDiff_NoChanges(t *testing.T) {
+	track, err := Read(bytes.NewBufferString(diffOld))
+	require.NoError(t, err)
+	d := Diff(track, track)
+	assert.False(t, d.Changed)
+	assert.Empty(t, d.Structs)
+}
+
+func TestDiff_MergedHistory(t *testing.T) {
+	oldTrack, err := Read(bytes.NewBufferString(diffOld))
+	require.NoError(t, err)
+	// the new file only tracks the versions since 1.15.0, but its entries start before them, so none of
+	// the "since" versions of both files is tracked by both
+	newTrack, err := Read(bytes.NewBufferString(`{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.15.0", "newest": "1.20.0" },
+				"offsets": [ { "offset": 8, "since": "1.10.0", "type": "string" } ]
+			}
+		}
+	},
+	"structs": { "net/http.Request": { "sizes": [ { "size": 256, "since": "1.10.0" } ] } }
+}`))
+	require.NoError(t, err)
+	oldTrack.Structs = map[string]StructInfo{"net/http.Request": {Sizes: []VersionedSize{{Size: 248, Since: "1.12.0"}}}}
+
+	d := Diff(oldTrack, newTrack)
+	assert.True(t, d.Changed)
+	require.NotEmpty(t, d.Structs)
+	req := d.Structs[0]
+	require.NotEmpty(t, req.Fields)
+	assert.Equal(t, "Method", req.Fields[0].Field)
+	assert.Equal(t, []ChangedVersion{{
+		Version: "1.15.0",
+		Old:     Versioned{Offset: 0, Since: "1.12.0", Type: "string"},
+		New:     Versioned{Offset: 8, Since: "1.10.0", Type: "string"},
+	}}, req.Fields[0].Changed)
+	assert.Equal(t, []ChangedSize{{Version: "1.15.0", Old: 248, New: 256}}, req.ChangedSizes)
+}
+
+func TestDiff_StructSizes(t *testing.T) {
+	oldTrack, err := Read(bytes.NewBufferString(diffOld))
+	require.NoError(t, err)
+	newTrack, err := Read(bytes.NewBufferString(diffOld))
+	require.NoError(t, err)
+	oldTrack.Structs = map[string]StructInfo{"net/http.Request": {Sizes: []VersionedSize{{Size: 248, Since: "1.12.0"}}}}
+	// the size of 1.21.0 is out of the tracked versions, so it is not compared
+	newTrack.Structs = map[string]StructInfo{"net/http.Request": {Sizes: []VersionedSize{
+		{Size: 248, Since: "1.12.0"}, {Size: 256, Since: "1.20.0"}, {Size: 264, Since: "1.21.0"},
+	}}}
+
+	d := Diff(oldTrack, newTrack)
+	assert.True(t, d.Changed)
+	require.Len(t, d.Structs, 1)
+	assert.Equal(t, StructDiff{Struct: "net/http.Request", ChangedSizes: []ChangedSize{
+		{Version: "1.20.0", Old: 248, New: 256},
+	}}, d.Structs[0])
+
+	md := strings.Builder{}
+	require.NoError(t, d.WriteMarkdown(&md))
+	assert.Contains(t, md.String(), "* **struct size changed** `1.20.0`: 248 → 256\n")
+}
@@ -1,5 +1,12 @@
 package offsets
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
 const GoStdLib = "go"
 
 // InputLibs key: name of the library, or "go" for the Go standard library
@@ -25,8 +32,199 @@ type LibQuery struct {
 	// larger or equal to 1.12
 	Versions string `json:"versions"`
 
+	// Architectures whose offsets are retrieved, as accepted by the GOARCH environment
+	// variable (e.g. amd64, arm64, 386, arm, ppc64le, s390x, riscv64). If empty, only
+	// the amd64 offsets are retrieved.
+	Architectures []string `json:"architectures"`
+
+	// StructVersions key: qualified name of the struct. Value: versions constraint where the fields of
+	// the struct are tracked, with the same syntax as Versions (e.g. ">= 1.20, < 1.23")
+	StructVersions map[string]string `json:"struct_versions"`
+
+	// FieldVersions key: qualified name of the struct. Value: key: name of the field, value: versions
+	// constraint where the field is tracked, with the same syntax as Versions. The constraints of the
+	// field and its struct must be both satisfied.
+	FieldVersions map[string]map[string]string `json:"field_versions"`
+
 	// Fields key: qualified name of the struct.
 	// Examples: net/http.Request, google.golang.org/grpc/internal/transport.Stream
-	// Value: list of case-sensitive name of the fields whose offsets we want to retrieve
+	// Value: list of case-sensitive name of the fields whose offsets we want to retrieve.
+	// A field can be a path that goes through other fields, using "." to access a field of a struct
+	// value (e.g. an embedded struct: "Stream.ctx") and "->" to access a field through a pointer
+	// (e.g. "URL->Path"). The offsets file will record the offset of each hop in the path.
+	// A field name can be prefixed by a "[min,max]" versions range (e.g. "[1.12,1.19]URL"), which is
+	// equivalent to the ">= min, <= max" constraint in FieldVersions. Both min and max are optional.
 	Fields map[string][]string
+
+	// Optional fields, with the same format as Fields, that might not exist in some versions. The
+	// versions where an optional field, or its struct, does not exist are recorded as absent in the
+	// offsets file, instead of failing.
+	Optional map[string][]string `json:"optional"`
+
+	// Aliases key: logical name of a struct, as used in Fields and Optional. Value: the names of
+	// the struct and its fields in the analyzed binaries, for the version ranges where they were
+	// renamed or moved to another package. The offsets file only records the logical names.
+	Aliases map[string][]Alias `json:"aliases"`
+}
+
+// Alias of a struct and its fields, for a version range
+type Alias struct {
+	// Versions constraint of the analyzed library where the alias applies. E.g. ">= 1.24".
+	// If many aliases of a struct match a version, the first one applies
+	Versions string `json:"versions"`
+
+	// Struct is the qualified name of the struct in the analyzed binaries. If empty, it is
+	// the logical name of the struct
+	Struct string `json:"struct"`
+
+	// Fields key: logical name of the field. Value: name of the field in the analyzed binaries
+	Fields map[string]string `json:"fields"`
+}
+
+// Validate checks that all the versions constraints of the input file can be parsed, and that the
+// structs and fields of the versions constraints are tracked
+func (il InputLibs) Validate() error {
+	for name, lib := range il {
+		if err := lib.validate(); err != nil {
+			return fmt.Errorf("library %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// TrackedFields returns the fields that are tracked by any library, including the optional fields.
+// Key: struct name. Value: set of field names, without their "[min,max]" prefix
+func (il InputLibs) TrackedFields() map[string]map[string]bool {
+	tracked := map[string]map[string]bool{}
+	for _, lib := range il {
+		lib.trackedFields(tracked)
+	}
+	return tracked
+}
+
+// trackedFields adds the fields and optional fields of the library to the tracked fields set
+func (q *LibQuery) trackedFields(tracked map[string]map[string]bool) {
+	for _, fields := range []map[string][]string{q.Fields, q.Optional} {
+		for structName, entries := range fields {
+			if tracked[structName] == nil {
+				tracked[structName] = map[string]bool{}
+			}
+			for _, entry := range entries {
+				field, _, _ := parseFieldName(entry)
+				tracked[structName][field] = true
+			}
+		}
+	}
+}
+
+// Aliases returns the aliases of the structs of all the libraries
+func (il InputLibs) Aliases() map[string][]Alias {
+	aliases := map[string][]Alias{}
+	for _, lib := range il {
+		for structName, structAliases := range lib.Aliases {
+			aliases[structName] = append(aliases[structName], structAliases...)
+		}
+	}
+	return aliases
+}
+
+func (q *LibQuery) validate() error {
+	if q.Versions != "" {
+		if _, err := version.NewConstraint(q.Versions); err != nil {
+			return fmt.Errorf("invalid versions constraint %q: %w", q.Versions, err)
+		}
+	}
+	tracked := map[string]map[string]bool{}
+	q.trackedFields(tracked)
+	for structName, constraint := range q.StructVersions {
+		if tracked[structName] == nil {
+			return fmt.Errorf("struct_versions: %s is not in the fields or optional fields", structName)
+		}
+		if _, err := version.NewConstraint(constraint); err != nil {
+			return fmt.Errorf("invalid versions constraint %q for %s: %w", constraint, structName, err)
+		}
+	}
+	for structName, fields := range q.FieldVersions {
+		for field, constraint := range fields {
+			if !tracked[structName][field] {
+				return fmt.Errorf("field_versions: %s %s is not in the fields or optional fields", structName, field)
+			}
+			if _, err := version.NewConstraint(constraint); err != nil {
+				return fmt.Errorf("invalid versions constraint %q for %s %s: %w", constraint, structName, field, err)
+			}
+		}
+	}
+	for _, fields := range []map[string][]string{q.Fields, q.Optional} {
+		for structName, entries := range fields {
+			for _, entry := range entries {
+				if _, _, err := q.FieldConstraints(structName, entry); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for structName, aliases := range q.Aliases {
+		for _, alias := range aliases {
+			if _, err := version.NewConstraint(alias.Versions); err != nil {
+				return fmt.Errorf("invalid versions constraint %q in the aliases of %s: %w",
+					alias.Versions, structName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FieldConstraints returns the name of a field entry of Fields or Optional, without its "[min,max]"
+// prefix, and the versions constraints where it is tracked. They combine the constraints of the struct
+// in StructVersions, of the field in FieldVersions, and of the prefix. The constraints are empty if
+// the field is tracked in all the versions.
+func (q *LibQuery) FieldConstraints(structName, entry string) (string, version.Constraints, error) {
+	field, minVer, maxVer := parseFieldName(entry)
+	var exprs []string
+	if c := q.StructVersions[structName]; c != "" {
+		exprs = append(exprs, c)
+	}
+	if c := q.FieldVersions[structName][field]; c != "" {
+		exprs = append(exprs, c)
+	}
+	if minVer != "" {
+		exprs = append(exprs, ">= "+minVer)
+	}
+	if maxVer != "" {
+		exprs = append(exprs, "<= "+maxVer)
+	}
+	if len(exprs) == 0 {
+		return field, nil, nil
+	}
+	constraints, err := version.NewConstraint(strings.Join(exprs, ", "))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid versions constraint for %s %s: %w", structName, field, err)
+	}
+	return field, constraints, nil
+}
+
+// parseFieldName splits a field entry into the field name and the min and max versions of its
+// optional "[min,max]" prefix
+func parseFieldName(f string) (string, string, string) {
+	if strings.HasPrefix(f, "[") {
+		l := strings.Index(f, "]")
+
+		if l > 0 {
+			versionsStr := f[1:l]
+
+			if len(versionsStr) > 0 {
+				versions := strings.Split(versionsStr, ",")
+
+				if len(versions) > 0 {
+					if len(versions) > 1 {
+						return f[l+1:], versions[0], versions[1]
+					} else {
+						return f[l+1:], versions[0], ""
+					}
+				}
+			}
+		}
+	}
+
+	return f, "", ""
 }
@@ -0,0 +1,47 @@
+package offsets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := InputLibs{"go": {
+		Versions:       ">= 1.12",
+		StructVersions: map[string]string{"net/http.Request": ">= 1.20, < 1.23"},
+		FieldVersions:  map[string]map[string]string{"net/http.Request": {"Pattern": ">= 1.22"}},
+		Fields:         map[string][]string{"net/http.Request": {"Method", "[1.22]Pattern"}},
+	}}
+	require.NoError(t, valid.Validate())
+
+	for name, lib := range map[string]LibQuery{
+		"versions":        {Versions: "latest"},
+		"struct versions": {StructVersions: map[string]string{"s": "> one"}, Fields: map[string][]string{"s": {"f"}}},
+		"field versions":  {FieldVersions: map[string]map[string]string{"s": {"f": "~>"}}, Fields: map[string][]string{"s": {"f"}}},
+		"prefix":          {Optional: map[string][]string{"s": {"[one]f"}}},
+		// the constraints of structs and fields that are not tracked are also checked
+		"untracked struct versions": {StructVersions: map[string]string{"s": "> one"}},
+		"untracked field versions":  {FieldVersions: map[string]map[string]string{"s": {"g": "~>"}}, Fields: map[string][]string{"s": {"f"}}},
+		"unknown struct":            {StructVersions: map[string]string{"t": ">= 1.0"}, Fields: map[string][]string{"s": {"f"}}},
+		"unknown field":             {FieldVersions: map[string]map[string]string{"s": {"g": ">= 1.0"}}, Fields: map[string][]string{"s": {"f"}}},
+		"unknown field struct":      {FieldVersions: map[string]map[string]string{"t": {"f": ">= 1.0"}}, Fields: map[string][]string{"s": {"f"}}},
+		"aliases":                   {Aliases: map[string][]Alias{"s": {{Versions: "?"}}}},
+	} {
+		assert.Errorf(t, InputLibs{"lib": lib}.Validate(), name)
+	}
+}
+
+func TestFieldConstraints(t *testing.T) {
+	lib := &LibQuery{StructVersions: map[string]string{"s": ">= 1.20"}}
+	field, constraints, err := lib.FieldConstraints("s", "[,1.22]f")
+	require.NoError(t, err)
+	assert.Equal(t, "f", field)
+	assert.Equal(t, ">= 1.20, <= 1.22", constraints.String())
+
+	field, constraints, err = lib.FieldConstraints("other", "f")
+	require.NoError(t, err)
+	assert.Equal(t, "f", field)
+	assert.Empty(t, constraints)
+}
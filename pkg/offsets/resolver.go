@@ -0,0 +1,229 @@
+package offsets
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// Resolved contains all the tracked offsets that apply to a given Go executable
+type Resolved struct {
+	// GoVersion of the compiler that built the executable, without the "go" prefix
+	GoVersion string
+	// Arch is the GOARCH of the executable
+	Arch string
+	// Modules key: module path, value: version of each module that is linked into the executable
+	Modules map[string]string
+	// Fields key: struct name. Value: key: field name, value: tracked info of the field
+	Fields map[string]map[string]*Versioned
+	// Absent key: struct name. Value: optional fields that do not exist in the linked version
+	Absent map[string][]string
+	// Missing contains the tracked structs that belong to the Go standard library or to any
+	// module linked into the executable, but that do not have data for the found versions
+	Missing []MissingStruct
+}
+
+// MissingStruct is a tracked struct without data for the version that is linked into an executable
+type MissingStruct struct {
+	Struct string
+	// Module that contains the struct, or GoStdLib if it belongs to the Go standard library
+	Module  string
+	Version string
+	// Fields that do not have data for the version
+	Fields []string
+}
+
+// Find the offset of a field struct name in the resolved executable
+func (r *Resolved) Find(structName, fieldName string) (uint64, bool) {
+	field, ok := r.Fields[structName][fieldName]
+	if !ok {
+		return 0, false
+	}
+	return field.Offset, true
+}
+
+// ResolveExecutable returns all the tracked offsets that apply to the executable in the provided path
+func (to *Track) ResolveExecutable(path string) (*Resolved, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening executable: %w", err)
+	}
+	defer f.Close()
+	return to.Resolve(f)
+}
+
+// Resolve reads the build information of a Go executable and returns all the tracked offsets
+// for the Go version, the module versions and the architecture of the executable
+func (to *Track) Resolve(exe io.ReaderAt) (*Resolved, error) {
+	bi, err := buildinfo.Read(exe)
+	if err != nil {
+		return nil, fmt.Errorf("reading build info: %w", err)
+	}
+	res := &Resolved{
+		GoVersion: strings.TrimPrefix(bi.GoVersion, "go"),
+		Fields:    map[string]map[string]*Versioned{},
+		Absent:    map[string][]string{},
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "GOARCH" {
+			res.Arch = s.Value
+		}
+	}
+	if res.Arch == "" {
+		// executables built before Go 1.18 do not store the build settings
+		if res.Arch, err = elfArch(exe); err != nil {
+			return nil, err
+		}
+	}
+	res.Modules = LinkedModules(bi)
+
+	modules := make([]string, 0, len(res.Modules))
+	for mod := range res.Modules {
+		modules = append(modules, mod)
+	}
+
+	structNames := make([]string, 0, len(to.Data))
+	for name := range to.Data {
+		structNames = append(structNames, name)
+	}
+	sort.Strings(structNames)
+	for _, structName := range structNames {
+		module := ModuleOf(StructPackage(structName), modules)
+		if module == "" {
+			// the struct is not part of the executable
+			continue
+		}
+		modVersion := res.GoVersion
+		if module != GoStdLib {
+			modVersion = res.Modules[module]
+		}
+		res.resolveStruct(structName, to.Data[structName], module, modVersion)
+	}
+	return res, nil
+}
+
+func (r *Resolved) resolveStruct(structName string, strct Struct, module, modVersion string) {
+	// versions like "(devel)" can't be compared with the tracked versions. Suffixes like the
+	// GOEXPERIMENT of the toolchain (e.g. "1.22.0 X:boringcrypto") are ignored
+	_, err := version.NewVersion(versions.CleanVersion(modVersion))
+	valid := err == nil
+	var missing []string
+	for fieldName, field := range strct {
+		var od *Versioned
+		ok := false
+		if valid {
+			od, ok = field.Get(r.Arch, modVersion)
+		}
+		if !ok {
+			missing = append(missing, fieldName)
+			continue
+		}
+		if od.Absent {
+			r.Absent[structName] = append(r.Absent[structName], fieldName)
+			continue
+		}
+		fields, ok := r.Fields[structName]
+		if !ok {
+			fields = map[string]*Versioned{}
+			r.Fields[structName] = fields
+		}
+		fields[fieldName] = od
+	}
+	sort.Strings(r.Absent[structName])
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		r.Missing = append(r.Missing, MissingStruct{
+			Struct:  structName,
+			Module:  module,
+			Version: modVersion,
+			Fields:  missing,
+		})
+	}
+}
+
+// LinkedModules returns the version of each module that is linked into an executable, according
+// to its build information. Replaced modules report the version of their replacement, if any
+func LinkedModules(bi *buildinfo.BuildInfo) map[string]string {
+	modules := map[string]string{}
+	if bi.Main.Path != "" {
+		modules[bi.Main.Path] = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			modules[dep.Path] = dep.Replace.Version
+		} else {
+			modules[dep.Path] = dep.Version
+		}
+	}
+	return modules
+}
+
+// StructPackage returns the package path of a qualified struct name.
+// E.g. for golang.org/x/net/http2.FrameHeader, it returns golang.org/x/net/http2
+func StructPackage(structName string) string {
+	// ignore type parameters, which might contain other qualified names
+	if idx := strings.IndexByte(structName, '['); idx >= 0 {
+		structName = structName[:idx]
+	}
+	slash := strings.LastIndexByte(structName, '/')
+	dot := strings.IndexByte(structName[slash+1:], '.')
+	if dot < 0 {
+		return structName
+	}
+	return structName[:slash+1+dot]
+}
+
+// ModuleOf returns the module from the provided list that contains the package. If the package does
+// not belong to any module and it looks like a standard library package, it returns GoStdLib.
+// Otherwise, it returns an empty string.
+func ModuleOf(pkg string, modules []string) string {
+	owner := ""
+	for _, mod := range modules {
+		if (pkg == mod || strings.HasPrefix(pkg, mod+"/")) && len(mod) > len(owner) {
+			owner = mod
+		}
+	}
+	if owner != "" {
+		return owner
+	}
+	// the first element of the standard library packages does not contain any dot
+	if first, _, _ := strings.Cut(pkg, "/"); !strings.Contains(first, ".") {
+		return GoStdLib
+	}
+	return ""
+}
+
+var elfMachines = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_386:     "386",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_ARM:     "arm",
+	elf.EM_PPC64:   "ppc64le",
+	elf.EM_S390:    "s390x",
+	elf.EM_RISCV:   "riscv64",
+}
+
+// elfArch returns the GOARCH of an ELF executable
+func elfArch(exe io.ReaderAt) (string, error) {
+	f, err := elf.NewFile(exe)
+	if err != nil {
+		return "", fmt.Errorf("reading ELF file: %w", err)
+	}
+	arch, ok := elfMachines[f.Machine]
+	if !ok {
+		return "", fmt.Errorf("unsupported ELF machine: %s", f.Machine)
+	}
+	if f.Machine == elf.EM_PPC64 && f.ByteOrder != binary.LittleEndian {
+		arch = "ppc64"
+	}
+	return arch, nil
+}
@@ -0,0 +1,110 @@
+package offsets
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveExecutable(t *testing.T) {
+	dataFile := `{
+	"data" : {
+		"github.com/stretchr/testify/assert.CollectT" : {
+			"errors" : {
+				"offsets": [
+					{ "offset": 1, "since": "1.0.0" },
+					{ "offset": 2, "since": "1.0.0", "arch": "arm64" },
+					{ "offset": 3, "since": "1.0.0", "arch": "386" }
+				]
+			}
+		},
+		"net/http.Request" : {
+			"Method" : {
+				"offsets": [
+					{ "offset": 10, "since": "1.0.0" },
+					{ "offset": 20, "since": "1.0.0", "arch": "arm64" },
+					{ "offset": 30, "since": "1.0.0", "arch": "386" }
+				]
+			},
+			"Unreleased" : {
+				"offsets": [
+					{ "offset": 40, "since": "999.0.0" }
+				]
+			}
+		},
+		"github.com/unlinked/module.Struct" : {
+			"field" : {
+				"offsets": [
+					{ "offset": 50, "since": "0.0.1" }
+				]
+			}
+		}
+	}
+}`
+	tracker, err := Read(bytes.NewBufferString(dataFile))
+	require.NoError(t, err)
+
+	// the test executable is a Go binary that includes the testify module
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	res, err := tracker.ResolveExecutable(exe)
+	require.NoError(t, err)
+
+	assert.Equal(t, runtime.GOARCH, res.Arch)
+	assert.Contains(t, runtime.Version(), res.GoVersion)
+	assert.Contains(t, res.Modules, "github.com/stretchr/testify")
+
+	if runtime.GOARCH == "amd64" {
+		off, ok := res.Find("github.com/stretchr/testify/assert.CollectT", "errors")
+		assert.True(t, ok)
+		assert.EqualValues(t, 1, off)
+		off, ok = res.Find("net/http.Request", "Method")
+		assert.True(t, ok)
+		assert.EqualValues(t, 10, off)
+	}
+	_, ok := res.Find("net/http.Request", "Unreleased")
+	assert.False(t, ok)
+	_, ok = res.Find("github.com/unlinked/module.Struct", "field")
+	assert.False(t, ok)
+
+	require.Len(t, res.Missing, 1)
+	assert.Equal(t, "net/http.Request", res.Missing[0].Struct)
+	assert.Equal(t, GoStdLib, res.Missing[0].Module)
+	assert.Equal(t, []string{"Unreleased"}, res.Missing[0].Fields)
+}
+
+func TestResolveStruct_ExperimentVersion(t *testing.T) {
+	strct := Struct{"Method": {Offsets: []Versioned{{Offset: 10, Since: "1.0.0"}}}}
+	res := &Resolved{Arch: "amd64", Fields: map[string]map[string]*Versioned{}, Absent: map[string][]string{}}
+	// toolchains built with a GOEXPERIMENT report it after the version
+	res.resolveStruct("net/http.Request", strct, GoStdLib, "1.22.0 X:boringcrypto")
+	off, ok := res.Find("net/http.Request", "Method")
+	assert.True(t, ok)
+	assert.EqualValues(t, 10, off)
+	assert.Empty(t, res.Missing)
+
+	res.resolveStruct("net/url.URL", Struct{"Path": strct["Method"]}, GoStdLib, "(devel)")
+	require.Len(t, res.Missing, 1)
+	assert.Equal(t, []string{"Path"}, res.Missing[0].Fields)
+}
+
+func TestStructPackage(t *testing.T) {
+	assert.Equal(t, "net/http", StructPackage("net/http.Request"))
+	assert.Equal(t, "runtime", StructPackage("runtime.g"))
+	assert.Equal(t, "golang.org/x/net/http2", StructPackage("golang.org/x/net/http2.FrameHeader"))
+	assert.Equal(t, "example.com/pkg", StructPackage("example.com/pkg.List[example.com/other.Item]"))
+}
+
+func TestModuleOf(t *testing.T) {
+	modules := []string{"google.golang.org/grpc", "golang.org/x/net", "google.golang.org/grpc/examples"}
+	assert.Equal(t, "google.golang.org/grpc", ModuleOf("google.golang.org/grpc/internal/transport", modules))
+	assert.Equal(t, "google.golang.org/grpc/examples", ModuleOf("google.golang.org/grpc/examples/foo", modules))
+	assert.Equal(t, "golang.org/x/net", ModuleOf("golang.org/x/net/http2", modules))
+	assert.Equal(t, GoStdLib, ModuleOf("net/http", modules))
+	assert.Equal(t, GoStdLib, ModuleOf("vendor/golang.org/x/net/http2/hpack", modules))
+	assert.Equal(t, "", ModuleOf("github.com/other/module", modules))
+}
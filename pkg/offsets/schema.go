@@ -26,19 +26,63 @@ import (
 	"github.com/grafana/go-offsets-tracker/pkg/versions"
 )
 
+// DefaultArch is the architecture of the offsets that do not explicitly specify any architecture.
+// Files generated before the architecture was tracked only contain offsets for this architecture.
+const DefaultArch = "amd64"
+
 type Track struct {
 	// Data key: struct name, which includes the library name in external libraries
 	Data map[string]Struct `json:"data"`
+	// Structs key: struct name. Value: tracked information of the whole struct, which is recorded
+	// once instead of in each of its fields
+	Structs map[string]StructInfo `json:"structs,omitempty"`
+	// Modules key: path of a module whose structs have been tracked through the versions of
+	// other libraries that depend on it. The offsets of these structs refer to the versions
+	// of the module that owns them, not to the versions of the analyzed libraries.
+	Modules map[string]Module `json:"modules,omitempty"`
+}
+
+// Module records the versions of a dependency module that were linked into the analyzed libraries
+type Module struct {
+	// Seen key: analyzed library and version, as returned by SeenKey.
+	// Value: version of the module that was linked into that library version
+	Seen map[string]string `json:"seen"`
+}
+
+// SeenKey returns the key of the Module.Seen map for a given library version
+// (e.g. google.golang.org/grpc@1.54.0)
+func SeenKey(lib, libVersion string) string {
+	return lib + "@" + versions.OrZero(libVersion).String()
 }
 
 // Struct key: field name
 type Struct map[string]Field
 
+// StructInfo contains the tracked information of a struct
+type StructInfo struct {
+	// Sizes of the struct since each version where it changed. They must be sorted
+	// from older to newer semantic version
+	Sizes []VersionedSize `json:"sizes"`
+}
+
+// VersionedSize is the size in bytes of a struct since a given version
+type VersionedSize struct {
+	Size  uint64 `json:"size"`
+	Since string `json:"since"`
+	// Arch is the architecture of the binaries where the size has been found.
+	// If empty, it is DefaultArch.
+	Arch string `json:"arch,omitempty"`
+}
+
 // Field offests must be sorted from higher to lower semantic version
 type Field struct {
-	// Versions range that are tracked for this given field
+	// Versions range that are tracked for this given field, in any architecture
 	Versions VersionInfo `json:"versions"`
-	Offsets  []Versioned `json:"offsets"`
+	// ArchVersions key: architecture. Value: versions range that are tracked in that architecture.
+	// It is only set if the field is tracked in more than one architecture. Otherwise, Versions
+	// is the range of the only architecture of the Offsets
+	ArchVersions map[string]VersionInfo `json:"arch_versions,omitempty"`
+	Offsets      []Versioned            `json:"offsets"`
 }
 
 type VersionInfo struct {
@@ -49,6 +93,49 @@ type VersionInfo struct {
 type Versioned struct {
 	Offset uint64 `json:"offset"`
 	Since  string `json:"since"`
+	// Arch is the architecture of the binaries where the offset has been found.
+	// If empty, it is DefaultArch.
+	Arch string `json:"arch,omitempty"`
+	// Path contains the hops to reach fields that are specified as a path (e.g. URL->Path).
+	// In that case, Offset is the offset from the start of the struct that is accessed after
+	// the last pointer dereference.
+	Path []Hop `json:"path,omitempty"`
+	// Size in bytes of the field
+	Size uint64 `json:"size,omitempty"`
+	// Type name of the field (e.g. string, []uint8, *net/url.URL)
+	Type string `json:"type,omitempty"`
+	// Absent is true if the field, which is optional, does not exist since the Since version.
+	// Then, the rest of properties are not set
+	Absent bool `json:"absent,omitempty"`
+}
+
+// Presence of a field in a given version
+type Presence int
+
+const (
+	// NotTracked means that the struct, the field, or the version are not tracked
+	NotTracked Presence = iota
+	// Present means that the field exists in the version, and its offset is known
+	Present
+	// Absent means that the field is tracked, but it does not exist in the version
+	Absent
+)
+
+// Hop is each of the fields that need to be traversed to reach a field specified as a path
+type Hop struct {
+	Field string `json:"field"`
+	// Offset from the start of the struct that contains the field
+	Offset uint64 `json:"offset"`
+	// Deref is true if the field is a pointer that needs to be dereferenced to reach the next hop
+	Deref bool `json:"deref,omitempty"`
+}
+
+// ArchOrDefault returns the passed architecture, or DefaultArch if it is empty
+func ArchOrDefault(arch string) string {
+	if arch == "" {
+		return DefaultArch
+	}
+	return arch
 }
 
 func Open(file string) (*Track, error) {
@@ -78,24 +165,112 @@ func Read(in io.Reader) (*Track, error) {
 			})
 		}
 	}
+	for _, s := range offsets.Structs {
+		sort.SliceStable(s.Sizes, func(i, j int) bool {
+			return versions.MustParse(s.Sizes[i].Since).LessThan(versions.MustParse(s.Sizes[j].Since))
+		})
+	}
 	return &offsets, nil
 }
 
-// Find the offset of a field struct name, for a given lib version
+// Find the offset of a field struct name, for a given lib version in the DefaultArch architecture.
+// It returns false if the field is not tracked for that version, or if it is absent.
+// Use FindPresence to tell both cases apart.
 func (to *Track) Find(structName, fieldName, libVersion string) (uint64, bool) {
+	return to.FindArch(DefaultArch, structName, fieldName, libVersion)
+}
+
+// FindArch finds the offset of a field struct name, for a given lib version and architecture.
+// It returns false if the field is not tracked for that version, or if it is absent.
+func (to *Track) FindArch(arch, structName, fieldName, libVersion string) (uint64, bool) {
+	offset, presence := to.FindPresence(arch, structName, fieldName, libVersion)
+	return offset, presence == Present
+}
+
+// FindPresence finds the offset of a field struct name, for a given lib version and architecture, and
+// tells whether the field is present in that version, absent, or the version is not tracked
+func (to *Track) FindPresence(arch, structName, fieldName, libVersion string) (uint64, Presence) {
+	od, ok := to.Lookup(arch, structName, fieldName, libVersion)
+	switch {
+	case !ok:
+		return 0, NotTracked
+	case od.Absent:
+		return 0, Absent
+	default:
+		return od.Offset, Present
+	}
+}
+
+// Lookup returns all the tracked information of a field struct name, for a given lib version and
+// architecture. If the field is absent in the version, the returned info is marked as Absent
+func (to *Track) Lookup(arch, structName, fieldName, libVersion string) (*Versioned, bool) {
 	strct, ok := to.Data[structName]
 	if !ok {
-		return 0, false
+		return nil, false
 	}
 	field, ok := strct[fieldName]
 	if !ok {
+		return nil, false
+	}
+	return field.Get(arch, libVersion)
+}
+
+// StructSize returns the size in bytes of a struct, for a given lib version and architecture.
+// It assumes that the struct sizes are sorted from older to newer version
+func (to *Track) StructSize(arch, structName, libVersion string) (uint64, bool) {
+	sizes := to.Structs[structName].Sizes
+	arch = ArchOrDefault(arch)
+	target, err := version.NewVersion(versions.CleanVersion(libVersion))
+	if err != nil {
 		return 0, false
 	}
-	return field.GetOffset(libVersion)
+	// Search from the newest version (last in the slice)
+	for s := len(sizes) - 1; s >= 0; s-- {
+		if ArchOrDefault(sizes[s].Arch) != arch {
+			continue
+		}
+		if since, err := version.NewVersion(sizes[s].Since); err == nil && target.Compare(since) >= 0 {
+			return sizes[s].Size, true
+		}
+	}
+	return 0, false
+}
+
+// VersionsArch returns the versions range that is tracked for the field in the given architecture.
+// It returns false if the field is not tracked in that architecture
+func (field *Field) VersionsArch(arch string) (VersionInfo, bool) {
+	arch = ArchOrDefault(arch)
+	if field.ArchVersions != nil {
+		vi, ok := field.ArchVersions[arch]
+		return vi, ok
+	}
+	for _, od := range field.Offsets {
+		if ArchOrDefault(od.Arch) == arch {
+			return field.Versions, true
+		}
+	}
+	return VersionInfo{}, false
 }
 
-// GetOffset assumes that the fields offsets list is sorted from older to newer version
+// GetOffset returns the offset of the field for the given lib version in the DefaultArch architecture
 func (field *Field) GetOffset(libVersion string) (uint64, bool) {
+	return field.GetOffsetArch(DefaultArch, libVersion)
+}
+
+// GetOffsetArch returns the offset of the field for the given lib version and architecture.
+// It returns false if the version is not tracked, or if the field is absent
+func (field *Field) GetOffsetArch(arch, libVersion string) (uint64, bool) {
+	if od, ok := field.Get(arch, libVersion); ok && !od.Absent {
+		return od.Offset, true
+	}
+	return 0, false
+}
+
+// Get returns all the tracked information of the field for the given lib version and architecture.
+// If the field is absent in the version, the returned info is marked as Absent.
+// It assumes that the fields offsets list is sorted from older to newer version
+func (field *Field) Get(arch, libVersion string) (*Versioned, bool) {
+	arch = ArchOrDefault(arch)
 	libVersion = versions.CleanVersion(libVersion)
 	target, err := version.NewVersion(libVersion)
 	if err != nil {
@@ -105,6 +280,9 @@ func (field *Field) GetOffset(libVersion string) (uint64, bool) {
 	// Search from the newest version (last in the slice)
 	for o := len(field.Offsets) - 1; o >= 0; o-- {
 		od := &field.Offsets[o]
+		if ArchOrDefault(od.Arch) != arch {
+			continue
+		}
 		fieldVersion, err := version.NewVersion(od.Since)
 		if err != nil {
 			// shouldn't happen unless a bug in our code
@@ -114,9 +292,9 @@ func (field *Field) GetOffset(libVersion string) (uint64, bool) {
 			// if target version is larger or equal than lib version:
 			// we certainly know that it is the most recent tracked offset
 			// matching the target libVersion
-			return od.Offset, true
+			return od, true
 		}
 	}
 
-	return 0, false
+	return nil, false
 }
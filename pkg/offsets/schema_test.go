@@ -70,3 +70,71 @@ func TestGetFieldOffset_UnorthodoxVersions(t *testing.T) {
 	offset, ok = tracker.Find("struct_1", "field_1", "1.17.9#yahooooii")
 	assert.Falsef(t, ok, "found: %d", int(offset))
 }
+
+func TestGetFieldOffset_Architectures(t *testing.T) {
+	dataFile := `{
+	"data" : {
+		"struct_1" : { 
+			"field_1" : {
+				"offsets": [
+					{ "offset": 1187, "since": "1.18.7" },
+					{ "offset": 587, "since": "1.18.7", "arch": "386" },
+					{ "offset": 1190, "since": "1.19.0" },
+					{ "offset": 590, "since": "1.20.0", "arch": "386" }
+				]
+			}
+		}
+	}
+}`
+	tracker, err := Read(bytes.NewBufferString(dataFile))
+	require.NoError(t, err)
+
+	offset, ok := tracker.Find("struct_1", "field_1", "1.20.1")
+	assert.True(t, ok)
+	assert.Equal(t, 1190, int(offset))
+	offset, ok = tracker.FindArch("amd64", "struct_1", "field_1", "1.20.1")
+	assert.True(t, ok)
+	assert.Equal(t, 1190, int(offset))
+	offset, ok = tracker.FindArch("386", "struct_1", "field_1", "1.20.1")
+	assert.True(t, ok)
+	assert.Equal(t, 590, int(offset))
+	offset, ok = tracker.FindArch("386", "struct_1", "field_1", "1.19.3")
+	assert.True(t, ok)
+	assert.Equal(t, 587, int(offset))
+	offset, ok = tracker.FindArch("arm64", "struct_1", "field_1", "1.19.3")
+	assert.Falsef(t, ok, "found: %d", int(offset))
+}
+
+func TestFindPresence(t *testing.T) {
+	dataFile := `{
+	"data" : {
+		"struct_1" : { 
+			"field_1" : {
+				"versions": { "oldest": "1.18.0", "newest": "1.21.0" },
+				"offsets": [
+					{ "since": "1.18.0", "absent": true },
+					{ "offset": 1190, "since": "1.19.0" },
+					{ "since": "1.21.0", "absent": true }
+				]
+			}
+		}
+	}
+}`
+	tracker, err := Read(bytes.NewBufferString(dataFile))
+	require.NoError(t, err)
+
+	offset, presence := tracker.FindPresence(DefaultArch, "struct_1", "field_1", "1.20.1")
+	assert.Equal(t, Present, presence)
+	assert.Equal(t, 1190, int(offset))
+	_, presence = tracker.FindPresence(DefaultArch, "struct_1", "field_1", "1.18.3")
+	assert.Equal(t, Absent, presence)
+	_, presence = tracker.FindPresence(DefaultArch, "struct_1", "field_1", "1.21.0")
+	assert.Equal(t, Absent, presence)
+	_, presence = tracker.FindPresence(DefaultArch, "struct_1", "field_1", "1.17.9")
+	assert.Equal(t, NotTracked, presence)
+	_, presence = tracker.FindPresence(DefaultArch, "struct_1", "field_2", "1.20.1")
+	assert.Equal(t, NotTracked, presence)
+	// Find does not return the offset of absent fields
+	_, ok := tracker.Find("struct_1", "field_1", "1.18.3")
+	assert.False(t, ok)
+}
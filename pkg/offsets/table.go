@@ -0,0 +1,349 @@
+package offsets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// The table format is a compact binary encoding of a Track, which can be looked up without parsing
+// it or allocating memory, and whose fixed-size records can be loaded into BPF array maps.
+// All the integers are little endian. It contains, in this order:
+//   - A header of TableHeaderSize bytes: the TableMagic, the TableFormatVersion (uint16), 2 reserved
+//     bytes, and the number of architectures, fields and intervals, and the size of the strings
+//     section (uint32 each), followed by 8 reserved bytes.
+//   - The field records, of TableFieldSize bytes each, sorted by struct and field name: a reference
+//     to the struct name and to the field name, the index of the first interval of the field, and
+//     the number of intervals (uint32 each).
+//   - The interval records, of TableIntervalSize bytes each. The intervals of each field are sorted
+//     from older to newer version: the version since the interval applies, as packed by TableVersion
+//     (uint64), the offset (uint64), the field size and the struct size (uint32 each), a reference to
+//     the prerelease of the version (uint32), the length of the prerelease (uint16), the index of the
+//     architecture (uint8) and the flags (uint8): TableAbsent if the field is absent.
+//   - The architecture references (uint32 each).
+//   - The strings section. A string reference is the position of a string in this section. Each
+//     string is prefixed by its length (uint16).
+//
+// Unlike the JSON form, the table does not contain the field types, the hops of field
+// paths, the tracked versions ranges nor the dependency modules.
+const (
+	TableMagic         = "GOFT"
+	TableFormatVersion = 1
+	TableHeaderSize    = 32
+	TableFieldSize     = 16
+	TableIntervalSize  = 32
+	// TableAbsent flag of the intervals where the field is absent
+	TableAbsent = 1
+)
+
+// Table is a Track in the table format. Its lookups don't allocate memory
+type Table struct {
+	fields    []byte
+	intervals []byte
+	archs     []byte
+	strings   []byte
+}
+
+// OpenTable reads a file in the table format
+func OpenTable(file string) (*Table, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening offsets table: %w", err)
+	}
+	return ReadTable(data)
+}
+
+// ReadTable returns the table that is encoded in the data. The table keeps a reference to the data
+func ReadTable(data []byte) (*Table, error) {
+	if len(data) < TableHeaderSize || string(data[:4]) != TableMagic {
+		return nil, errors.New("not an offsets table")
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != TableFormatVersion {
+		return nil, fmt.Errorf("unsupported offsets table format version %d", v)
+	}
+	archs := uint64(binary.LittleEndian.Uint32(data[8:]))
+	fields := uint64(binary.LittleEndian.Uint32(data[12:]))
+	intervals := uint64(binary.LittleEndian.Uint32(data[16:]))
+	stringsLen := uint64(binary.LittleEndian.Uint32(data[20:]))
+	fieldsEnd := TableHeaderSize + fields*TableFieldSize
+	intervalsEnd := fieldsEnd + intervals*TableIntervalSize
+	archsEnd := intervalsEnd + archs*4
+	if uint64(len(data)) != archsEnd+stringsLen {
+		return nil, fmt.Errorf("invalid offsets table size %d, expected %d", len(data), archsEnd+stringsLen)
+	}
+	t := &Table{
+		fields:    data[TableHeaderSize:fieldsEnd],
+		intervals: data[fieldsEnd:intervalsEnd],
+		archs:     data[intervalsEnd:archsEnd],
+		strings:   data[archsEnd:],
+	}
+	if err := t.validate(); err != nil {
+		return nil, fmt.Errorf("invalid offsets table: %w", err)
+	}
+	return t, nil
+}
+
+// validate checks that all the references of the table are within its bounds, so the lookups can't panic
+func (t *Table) validate() error {
+	checkString := func(ref, length uint64) error {
+		if ref+2+length > uint64(len(t.strings)) {
+			return fmt.Errorf("string reference %d out of bounds", ref)
+		}
+		return nil
+	}
+	checkRef := func(ref uint32) error {
+		if uint64(ref)+2 > uint64(len(t.strings)) {
+			return fmt.Errorf("string reference %d out of bounds", ref)
+		}
+		return checkString(uint64(ref), uint64(binary.LittleEndian.Uint16(t.strings[ref:])))
+	}
+	for i := 0; i < len(t.archs); i += 4 {
+		if err := checkRef(binary.LittleEndian.Uint32(t.archs[i:])); err != nil {
+			return err
+		}
+	}
+	numIntervals := uint64(len(t.intervals) / TableIntervalSize)
+	for i := 0; i < len(t.fields); i += TableFieldSize {
+		rec := t.fields[i : i+TableFieldSize]
+		if err := checkRef(binary.LittleEndian.Uint32(rec)); err != nil {
+			return err
+		}
+		if err := checkRef(binary.LittleEndian.Uint32(rec[4:])); err != nil {
+			return err
+		}
+		first, count := binary.LittleEndian.Uint32(rec[8:]), binary.LittleEndian.Uint32(rec[12:])
+		if uint64(first)+uint64(count) > numIntervals {
+			return fmt.Errorf("intervals of field %d out of bounds", i/TableFieldSize)
+		}
+	}
+	numArchs := len(t.archs) / 4
+	for i := 0; i < len(t.intervals); i += TableIntervalSize {
+		rec := t.intervals[i : i+TableIntervalSize]
+		if err := checkString(uint64(binary.LittleEndian.Uint32(rec[24:])), uint64(binary.LittleEndian.Uint16(rec[28:]))); err != nil {
+			return err
+		}
+		if int(rec[30]) >= numArchs {
+			return fmt.Errorf("architecture of interval %d out of bounds", i/TableIntervalSize)
+		}
+	}
+	return nil
+}
+
+// FieldRecords returns the field records of the table, to be loaded into a BPF array map
+func (t *Table) FieldRecords() []byte {
+	return t.fields
+}
+
+// IntervalRecords returns the interval records of the table, to be loaded into a BPF array map
+func (t *Table) IntervalRecords() []byte {
+	return t.intervals
+}
+
+// Find the offset of a field struct name, for a given lib version in the DefaultArch architecture.
+// It returns false if the field is not tracked for that version, or if it is absent.
+func (t *Table) Find(structName, fieldName, libVersion string) (uint64, bool) {
+	return t.FindArch(DefaultArch, structName, fieldName, libVersion)
+}
+
+// FindArch finds the offset of a field struct name, for a given lib version and architecture.
+// It returns false if the field is not tracked for that version, or if it is absent.
+func (t *Table) FindArch(arch, structName, fieldName, libVersion string) (uint64, bool) {
+	offset, presence := t.FindPresence(arch, structName, fieldName, libVersion)
+	return offset, presence == Present
+}
+
+// FindPresence finds the offset of a field struct name, for a given lib version and architecture, and
+// tells whether the field is present in that version, absent, or the version is not tracked
+func (t *Table) FindPresence(arch, structName, fieldName, libVersion string) (uint64, Presence) {
+	rec, ok := t.interval(arch, structName, fieldName, libVersion)
+	switch {
+	case !ok:
+		return 0, NotTracked
+	case rec[31]&TableAbsent != 0:
+		return 0, Absent
+	default:
+		return binary.LittleEndian.Uint64(rec[8:]), Present
+	}
+}
+
+// StructSize returns the size in bytes of a struct, for a given lib version and architecture
+func (t *Table) StructSize(arch, structName, libVersion string) (uint64, bool) {
+	n := len(t.fields) / TableFieldSize
+	first := sort.Search(n, func(i int) bool {
+		return t.string(binary.LittleEndian.Uint32(t.fields[i*TableFieldSize:])) >= structName
+	})
+	for i := first; i < n; i++ {
+		rec := t.fields[i*TableFieldSize : (i+1)*TableFieldSize]
+		if t.string(binary.LittleEndian.Uint32(rec)) != structName {
+			break
+		}
+		if iv, ok := t.fieldInterval(rec, arch, libVersion); ok {
+			if size := binary.LittleEndian.Uint32(iv[20:]); size > 0 {
+				return uint64(size), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// interval returns the record of the newest interval of a field that is older or equal than the version
+func (t *Table) interval(arch, structName, fieldName, libVersion string) ([]byte, bool) {
+	n := len(t.fields) / TableFieldSize
+	i := sort.Search(n, func(i int) bool {
+		rec := t.fields[i*TableFieldSize:]
+		s := t.string(binary.LittleEndian.Uint32(rec))
+		return s > structName || (s == structName && t.string(binary.LittleEndian.Uint32(rec[4:])) >= fieldName)
+	})
+	if i == n {
+		return nil, false
+	}
+	rec := t.fields[i*TableFieldSize : (i+1)*TableFieldSize]
+	if t.string(binary.LittleEndian.Uint32(rec)) != structName || t.string(binary.LittleEndian.Uint32(rec[4:])) != fieldName {
+		return nil, false
+	}
+	return t.fieldInterval(rec, arch, libVersion)
+}
+
+func (t *Table) fieldInterval(fieldRec []byte, arch, libVersion string) ([]byte, bool) {
+	target, targetPre, err := TableVersion(libVersion)
+	if err != nil {
+		return nil, false
+	}
+	arch = ArchOrDefault(arch)
+	first := int(binary.LittleEndian.Uint32(fieldRec[8:]))
+	count := int(binary.LittleEndian.Uint32(fieldRec[12:]))
+	// search from the newest version
+	for i := first + count - 1; i >= first; i-- {
+		rec := t.intervals[i*TableIntervalSize : (i+1)*TableIntervalSize]
+		if t.string(binary.LittleEndian.Uint32(t.archs[int(rec[30])*4:])) != arch {
+			continue
+		}
+		since := binary.LittleEndian.Uint64(rec)
+		sincePre := t.strings[binary.LittleEndian.Uint32(rec[24:])+2:][:binary.LittleEndian.Uint16(rec[28:])]
+		if compareVersions(target, targetPre, since, bytesString(sincePre)) >= 0 {
+			return rec, true
+		}
+	}
+	return nil, false
+}
+
+// string returns the string of a reference, without copying it
+func (t *Table) string(ref uint32) string {
+	length := binary.LittleEndian.Uint16(t.strings[ref:])
+	return bytesString(t.strings[ref+2 : ref+2+uint32(length)])
+}
+
+// bytesString returns a string that shares the memory of the bytes, which must not be modified
+func bytesString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// TableVersion parses a version as the table format stores it: the major, minor and patch
+// segments are packed into an integer (major<<32 | minor<<16 | patch), and the prerelease is
+// returned apart. As Track lookups, any suffix with characters that are not allowed in a version
+// is ignored, as well as the build metadata. It does not allocate memory.
+func TableVersion(v string) (uint64, string, error) {
+	if idx := strings.IndexFunc(v, func(r rune) bool {
+		return !(r == 'v' || r == '-' || r == '~' || r == '.' || r == '+' ||
+			(r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'))
+	}); idx >= 0 {
+		v = v[:idx]
+	}
+	if idx := strings.IndexByte(v, '+'); idx >= 0 {
+		v = v[:idx]
+	}
+	v = strings.TrimPrefix(v, "v")
+	var segments [3]uint64
+	seg, digits := 0, 0
+	i := 0
+	for ; i < len(v); i++ {
+		c := v[i]
+		if c >= '0' && c <= '9' {
+			segments[seg] = segments[seg]*10 + uint64(c-'0')
+			if segments[seg] > math.MaxUint32 {
+				return 0, "", errors.New("version segment too large: " + v)
+			}
+			digits++
+			continue
+		}
+		if c != '.' || digits == 0 || i+1 == len(v) || v[i+1] < '0' || v[i+1] > '9' {
+			break
+		}
+		if seg++; seg == len(segments) {
+			return 0, "", errors.New("too many version segments: " + v)
+		}
+		digits = 0
+	}
+	if digits == 0 || segments[1] > math.MaxUint16 || segments[2] > math.MaxUint16 {
+		return 0, "", errors.New("invalid version: " + v)
+	}
+	pre := strings.TrimPrefix(v[i:], "-")
+	if i < len(v) && (pre == "" || v[i] == '.') {
+		return 0, "", errors.New("invalid version: " + v)
+	}
+	return segments[0]<<32 | segments[1]<<16 | segments[2], pre, nil
+}
+
+// compareVersions compares two versions that are parsed by TableVersion, following the
+// semantic versioning precedence rules: a version with prerelease is lower than the same
+// version without prerelease
+func compareVersions(a uint64, aPre string, b uint64, bPre string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	// compare each dot-separated identifier of the prereleases
+	for aPre != "" && bPre != "" {
+		var aID, bID string
+		aID, aPre, _ = strings.Cut(aPre, ".")
+		bID, bPre, _ = strings.Cut(bPre, ".")
+		if c := compareIdentifiers(aID, bID); c != 0 {
+			return c
+		}
+	}
+	// a larger set of identifiers has a higher precedence
+	return strings.Compare(aPre, bPre)
+}
+
+// compareIdentifiers compares numeric identifiers numerically, and the rest lexically.
+// Numeric identifiers have lower precedence than the rest
+func compareIdentifiers(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
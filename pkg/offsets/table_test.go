@@ -0,0 +1,43 @@
+package offsets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableVersion(t *testing.T) {
+	for v, expected := range map[string]struct {
+		packed uint64
+		pre    string
+	}{
+		"1.21.3":         {1<<32 | 21<<16 | 3, ""},
+		"v1.21":          {1<<32 | 21<<16, ""},
+		"1.21.0-rc.2":    {1<<32 | 21<<16, "rc.2"},
+		"1.21rc2":        {1<<32 | 21<<16, "rc2"},
+		"1.2.3+incompat": {1<<32 | 2<<16 | 3, ""},
+		"1.2.3 (devel)":  {1<<32 | 2<<16 | 3, ""},
+	} {
+		packed, pre, err := TableVersion(v)
+		require.NoError(t, err, v)
+		assert.Equal(t, expected.packed, packed, v)
+		assert.Equal(t, expected.pre, pre, v)
+	}
+	for _, v := range []string{"", "devel", "1.", "1.2.3.4", "1.70000.0"} {
+		_, _, err := TableVersion(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"1.2.0-alpha", "1.2.0-alpha.1", "1.2.0-alpha.beta", "1.2.0-beta.2", "1.2.0-beta.11", "1.2.0-rc.1", "1.2.0", "1.2.1"}
+	for i := 1; i < len(ordered); i++ {
+		a, aPre, err := TableVersion(ordered[i-1])
+		require.NoError(t, err)
+		b, bPre, err := TableVersion(ordered[i])
+		require.NoError(t, err)
+		assert.Negative(t, compareVersions(a, aPre, b, bPre), "%s < %s", ordered[i-1], ordered[i])
+		assert.Positive(t, compareVersions(b, bPre, a, aPre), "%s > %s", ordered[i], ordered[i-1])
+	}
+}
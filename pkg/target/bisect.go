@@ -0,0 +1,140 @@
+package target
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// analyzeFunc returns the results of the provided versions, in the same order
+type analyzeFunc func(vers []string) ([]*VersionedResult, error)
+
+// interval of version indices whose both ends have been already analyzed
+type interval struct {
+	lo, hi int
+}
+
+func (t *targetData) bisect(a *analysis, vers []string) ([]*VersionedResult, error) {
+	return bisectVersions(t.name+" ("+a.arch+")", vers, t.verify, func(vers []string) ([]*VersionedResult, error) {
+		return t.analyzeVersions(a, vers)
+	})
+}
+
+// bisectVersions analyzes the oldest and newest of the provided versions. If the offsets of
+// both differ, it analyzes the version in the middle and repeats the process for each half,
+// until all the versions that changed any offset are found. The middle versions of all the
+// pending intervals are analyzed at the same time, so they can be analyzed concurrently.
+// The returned results are sorted from older to newer version and only contain the analyzed
+// versions, which is enough for the writer, as it only annotates the versions that changed
+// a given offset.
+// If verify is true, it analyzes all the versions that were skipped during the bisection
+// and reports the ones whose offsets differ from what was inferred.
+func bisectVersions(name string, vers []string, verify bool, analyze analyzeFunc) ([]*VersionedResult, error) {
+	if len(vers) == 0 {
+		return nil, nil
+	}
+	vers = append([]string{}, vers...)
+	sort.SliceStable(vers, func(i, j int) bool {
+		return versions.OrZero(vers[i]).LessThan(versions.OrZero(vers[j]))
+	})
+
+	analyzed := make([]*VersionedResult, len(vers))
+	// analyzeIdx concurrently analyzes the versions of the provided indices
+	analyzeIdx := func(idx ...int) error {
+		var pending []int
+		var pendingVers []string
+		for _, i := range idx {
+			if analyzed[i] == nil {
+				pending = append(pending, i)
+				pendingVers = append(pendingVers, vers[i])
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		results, err := analyze(pendingVers)
+		if err != nil {
+			return err
+		}
+		for n, i := range pending {
+			analyzed[i] = results[n]
+		}
+		return nil
+	}
+
+	if err := analyzeIdx(0, len(vers)-1); err != nil {
+		return nil, err
+	}
+	pending := []interval{{lo: 0, hi: len(vers) - 1}}
+	for len(pending) > 0 {
+		var mids []int
+		var next []interval
+		for _, iv := range pending {
+			// the offsets of failed versions are unknown, so the versions around them are bisected
+			if iv.hi-iv.lo < 2 || (!analyzed[iv.lo].Status.Failed() && !analyzed[iv.hi].Status.Failed() &&
+				!offsetsChanged(analyzed[iv.lo], analyzed[iv.hi])) {
+				continue
+			}
+			mid := (iv.lo + iv.hi) / 2
+			mids = append(mids, mid)
+			next = append(next, interval{lo: iv.lo, hi: mid}, interval{lo: mid, hi: iv.hi})
+		}
+		if err := analyzeIdx(mids...); err != nil {
+			return nil, err
+		}
+		pending = next
+	}
+
+	if verify {
+		// the inferred offsets for a skipped version are the offsets of the
+		// previous analyzed version
+		inferred := make([]*VersionedResult, len(vers))
+		var skipped []int
+		for i, vr := range analyzed {
+			if vr != nil {
+				inferred[i] = vr
+			} else {
+				inferred[i] = inferred[i-1]
+				skipped = append(skipped, i)
+			}
+		}
+		fmt.Printf("%s: verifying %d versions skipped by the bisection\n", name, len(skipped))
+		if err := analyzeIdx(skipped...); err != nil {
+			return nil, err
+		}
+		for _, i := range skipped {
+			if offsetsChanged(inferred[i], analyzed[i]) {
+				fmt.Printf("%s: WARNING: bisection missed an offsets change in version %s\n", name, vers[i])
+			}
+		}
+	}
+
+	var results []*VersionedResult
+	for _, vr := range analyzed {
+		if vr != nil {
+			results = append(results, vr)
+		}
+	}
+	return results, nil
+}
+
+// offsetsChanged returns true if any data member has a different offset in both results,
+// or is present in only one of them
+func offsetsChanged(a, b *VersionedResult) bool {
+	if len(a.OffsetData.DataMembers) != len(b.OffsetData.DataMembers) {
+		return true
+	}
+	aOffsets := make(map[string]*binary.DataMemberOffset, len(a.OffsetData.DataMembers))
+	for _, dm := range a.OffsetData.DataMembers {
+		aOffsets[dm.StructName+","+dm.Field] = dm
+	}
+	for _, dm := range b.OffsetData.DataMembers {
+		off, ok := aOffsets[dm.StructName+","+dm.Field]
+		if !ok || !off.Equal(dm) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package target
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+)
+
+// fakeAnalyzer returns offset 8 before 1.5.0, and offset 16 since 1.5.0
+type fakeAnalyzer struct {
+	analyzed []string
+}
+
+func (fa *fakeAnalyzer) analyze(vers []string) ([]*VersionedResult, error) {
+	var results []*VersionedResult
+	for _, v := range vers {
+		vr, err := fa.analyzeVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, vr)
+	}
+	return results, nil
+}
+
+func (fa *fakeAnalyzer) analyzeVersion(v string) (*VersionedResult, error) {
+	fa.analyzed = append(fa.analyzed, v)
+	var off uint64 = 8
+	var minor int
+	if _, err := fmt.Sscanf(v, "1.%d.0", &minor); err != nil {
+		return nil, err
+	}
+	if minor >= 5 {
+		off = 16
+	}
+	return &VersionedResult{
+		Version: v,
+		OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{{
+			DataMember: &binary.DataMember{StructName: "struct", Field: "field"},
+			Offset:     off,
+		}}},
+	}, nil
+}
+
+func resultVersions(results []*VersionedResult) []string {
+	var vers []string
+	for _, r := range results {
+		vers = append(vers, r.Version)
+	}
+	return vers
+}
+
+func TestBisectVersions(t *testing.T) {
+	var vers []string
+	for i := 20; i >= 0; i-- {
+		vers = append(vers, fmt.Sprintf("1.%d.0", i))
+	}
+	fa := fakeAnalyzer{}
+	results, err := bisectVersions("test", vers, false, fa.analyze)
+	require.NoError(t, err)
+
+	vs := resultVersions(results)
+	assert.Contains(t, vs, "1.0.0")
+	assert.Contains(t, vs, "1.4.0")
+	assert.Contains(t, vs, "1.5.0")
+	assert.Contains(t, vs, "1.20.0")
+	assert.Less(t, len(fa.analyzed), len(vers))
+	assert.Len(t, vs, len(fa.analyzed))
+}
+
+func TestBisectVersions_NoChanges(t *testing.T) {
+	fa := fakeAnalyzer{}
+	results, err := bisectVersions("test", []string{"1.5.0", "1.6.0", "1.7.0", "1.8.0"}, false, fa.analyze)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.5.0", "1.8.0"}, resultVersions(results))
+}
+
+func TestBisectVersions_Verify(t *testing.T) {
+	vers := []string{"1.1.0", "1.2.0", "1.3.0", "1.4.0", "1.5.0", "1.6.0"}
+	fa := fakeAnalyzer{}
+	results, err := bisectVersions("test", vers, true, fa.analyze)
+	require.NoError(t, err)
+	assert.Equal(t, vers, resultVersions(results))
+	assert.Len(t, fa.analyzed, len(vers))
+}
+
+func TestBisectVersions_Failed(t *testing.T) {
+	fa := fakeAnalyzer{}
+	// the oldest version fails, so the interval between it and the next version is bisected
+	results, err := bisectVersions("test", []string{"1.5.0", "1.6.0", "1.7.0", "1.8.0"}, false,
+		func(vers []string) ([]*VersionedResult, error) {
+			results, err := fa.analyze(vers)
+			for _, vr := range results {
+				if vr.Version == "1.5.0" {
+					vr.Status, vr.OffsetData.DataMembers = StatusBuildFailed, nil
+				}
+			}
+			return results, err
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.5.0", "1.6.0", "1.8.0"}, resultVersions(results))
+}
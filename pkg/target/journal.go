@@ -0,0 +1,166 @@
+package target
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+)
+
+// journalRecord is a line of the journal, with the result of a library version
+type journalRecord struct {
+	Library     string                     `json:"library"`
+	Version     string                     `json:"version"`
+	Arch        string                     `json:"arch"`
+	Status      Status                     `json:"status"`
+	DataMembers []*binary.DataMemberOffset `json:"data_members,omitempty"`
+}
+
+// Journal is a checkpoint file where each analyzed version is appended as soon as it finishes,
+// so an interrupted run can be resumed without downloading and analyzing these versions again.
+// It can be shared by many targets, and used concurrently.
+type Journal struct {
+	fileName string
+	mu       sync.Mutex
+	file     *os.File
+	// records of a previous run. Key: library,version,arch
+	records map[string]*journalRecord
+}
+
+// ErrJournalExists is returned when a run is not resumed, but the journal of an interrupted run exists
+var ErrJournalExists = errors.New("the journal of an interrupted run exists. Resume the run, or remove the journal to start over")
+
+// OpenJournal opens the journal in the provided file. If resume is true, the records of the existing
+// journal are replayed, and the new records are appended to it. Otherwise, it returns ErrJournalExists
+// if the journal is not empty, so the records of an interrupted run are not discarded by mistake.
+func OpenJournal(fileName string, resume bool) (*Journal, error) {
+	j := &Journal{fileName: fileName, records: map[string]*journalRecord{}}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !resume {
+		if info, err := os.Stat(fileName); err == nil && info.Size() > 0 {
+			return nil, fmt.Errorf("%s: %w", fileName, ErrJournalExists)
+		}
+	} else {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	var err error
+	if j.file, err = os.OpenFile(fileName, flags, 0o644); err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+	return j, nil
+}
+
+func (j *Journal) load() error {
+	file, err := os.Open(j.fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening journal: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		rec := &journalRecord{}
+		// the last line might be incomplete if the previous run was killed while writing it
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			continue
+		}
+		j.records[journalKey(rec.Library, rec.Version, rec.Arch)] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading journal: %w", err)
+	}
+	fmt.Printf("resuming %d versions from journal %s\n", len(j.records), j.fileName)
+	return nil
+}
+
+func journalKey(lib, version, arch string) string {
+	return lib + "," + version + "," + arch
+}
+
+// find returns the result of a library version that was recorded by a previous run, as long as it
+// contains all the provided data members. Otherwise, it returns nil
+func (j *Journal) find(lib, version, arch string, dms []*binary.DataMember) *VersionedResult {
+	if j == nil {
+		return nil
+	}
+	rec, ok := j.records[journalKey(lib, version, arch)]
+	if !ok {
+		return nil
+	}
+	vr := &VersionedResult{Version: version, Arch: arch, Status: rec.Status, OffsetData: &binary.Result{}}
+	if rec.Status == StatusNotAvailable {
+		return vr
+	}
+	recorded := make(map[string]*binary.DataMemberOffset, len(rec.DataMembers))
+	for _, dmo := range rec.DataMembers {
+		recorded[dmo.StructName+","+dmo.Field] = dmo
+	}
+	for _, dm := range dms {
+		dmo, ok := recorded[dm.StructName+","+dm.Field]
+		// absent fields need to be analyzed again if they are not optional anymore
+		if !ok || (dmo.Absent && !dm.Optional) {
+			return nil
+		}
+		vr.OffsetData.DataMembers = append(vr.OffsetData.DataMembers, &binary.DataMemberOffset{
+			DataMember:    dm,
+			Offset:        dmo.Offset,
+			Hops:          dmo.Hops,
+			Size:          dmo.Size,
+			StructSize:    dmo.StructSize,
+			Type:          dmo.Type,
+			Module:        dmo.Module,
+			ModuleVersion: dmo.ModuleVersion,
+			Absent:        dmo.Absent,
+		})
+	}
+	return vr
+}
+
+// record appends the result of a library version to the journal, and syncs it to disk
+func (j *Journal) record(lib string, vr *VersionedResult) error {
+	if j == nil {
+		return nil
+	}
+	line, err := json.Marshal(&journalRecord{
+		Library:     lib,
+		Version:     vr.Version,
+		Arch:        vr.Arch,
+		Status:      vr.Status,
+		DataMembers: vr.OffsetData.DataMembers,
+	})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Close the journal file. It waits for any ongoing record to be written
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Remove closes and removes the journal file, once the results have been safely written
+func (j *Journal) Remove() error {
+	if err := j.Close(); err != nil {
+		return err
+	}
+	return os.Remove(j.fileName)
+}
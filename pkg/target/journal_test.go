@@ -0,0 +1,67 @@
+package target
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+)
+
+func TestJournal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json.journal")
+	method := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	url := &binary.DataMember{StructName: "net/http.Request", Field: "URL"}
+
+	j, err := OpenJournal(file, false)
+	require.NoError(t, err)
+	require.NoError(t, j.record("go", &VersionedResult{
+		Version: "1.20.0", Arch: "amd64", Status: StatusOK,
+		OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{
+			{DataMember: method, Offset: 0, Size: 16, Type: "string"},
+			{DataMember: url, Offset: 16, Size: 8, Type: "*net/url.URL"},
+		}},
+	}))
+	require.NoError(t, j.record("go", &VersionedResult{
+		Version: "1.20.0", Arch: "arm", Status: StatusNotAvailable, OffsetData: &binary.Result{},
+	}))
+	require.NoError(t, j.Close())
+	// a run killed while writing a record leaves an incomplete line
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"library":"go","vers`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, err = OpenJournal(file, true)
+	require.NoError(t, err)
+	vr := j.find("go", "1.20.0", "amd64", []*binary.DataMember{url})
+	require.NotNil(t, vr)
+	assert.Equal(t, StatusOK, vr.Status)
+	require.Len(t, vr.OffsetData.DataMembers, 1)
+	assert.Equal(t, "URL", vr.OffsetData.DataMembers[0].Field)
+	assert.EqualValues(t, 16, vr.OffsetData.DataMembers[0].Offset)
+	assert.Equal(t, "*net/url.URL", vr.OffsetData.DataMembers[0].Type)
+
+	assert.Equal(t, StatusNotAvailable, j.find("go", "1.20.0", "arm", []*binary.DataMember{url}).Status)
+	// versions that are not recorded, or whose records miss any field, are analyzed again
+	assert.Nil(t, j.find("go", "1.21.0", "amd64", []*binary.DataMember{url}))
+	assert.Nil(t, j.find("go", "1.20.0", "amd64", []*binary.DataMember{url, {StructName: "net/http.Request", Field: "Host"}}))
+	require.NoError(t, j.Remove())
+	assert.NoFileExists(t, file)
+
+	// a new run does not discard the records of an interrupted run
+	require.NoError(t, os.WriteFile(file, []byte(`{"library":"go","version":"1.20.0","arch":"arm","status":"not_available"}`+"\n"), 0o644))
+	_, err = OpenJournal(file, false)
+	assert.ErrorIs(t, err, ErrJournalExists)
+
+	// an empty journal is truncated
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	j, err = OpenJournal(file, false)
+	require.NoError(t, err)
+	defer j.Close()
+	assert.Nil(t, j.find("go", "1.20.0", "arm", nil))
+}
@@ -0,0 +1,76 @@
+package target
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/grafana/go-offsets-tracker/pkg/downloader"
+)
+
+// WorkerPool bounds the number of versions that are concurrently downloaded, built and analyzed.
+// Each worker owns a temporary workspace, so the files of concurrent builds do not collide.
+// A WorkerPool can be shared by many targets, to bound the concurrency of the whole process.
+type WorkerPool struct {
+	// workspaces is used as a semaphore: each worker takes a workspace and returns it after finishing
+	workspaces chan string
+}
+
+// NewWorkerPool creates a WorkerPool with the provided number of workers. The WorkerPool must
+// be closed after its usage, to remove the temporary workspaces.
+func NewWorkerPool(workers int) (*WorkerPool, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	wp := &WorkerPool{workspaces: make(chan string, workers)}
+	for i := 0; i < workers; i++ {
+		dir, err := downloader.MkdirTemp("", fmt.Sprintf("worker%d-", i))
+		if err != nil {
+			close(wp.workspaces)
+			for created := range wp.workspaces {
+				downloader.RemoveTempDir(created)
+			}
+			return nil, fmt.Errorf("creating worker workspace: %w", err)
+		}
+		wp.workspaces <- dir
+	}
+	return wp, nil
+}
+
+// Close removes the workspaces of all the workers. It waits for the running workers to finish.
+func (wp *WorkerPool) Close() {
+	for i := 0; i < cap(wp.workspaces); i++ {
+		downloader.RemoveTempDir(<-wp.workspaces)
+	}
+}
+
+// run invokes the job function for each index in [0, jobs), with up to as many concurrent
+// invocations as workers are in the pool. Each job receives the workspace of the worker
+// running it. After the first error, the pending jobs are not run and the error is returned.
+func (wp *WorkerPool) run(jobs int, job func(workDir string, idx int) error) error {
+	errs := make([]error, jobs)
+	var failed atomic.Bool
+	wg := sync.WaitGroup{}
+	wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		workDir := <-wp.workspaces
+		go func(workDir string, idx int) {
+			defer wg.Done()
+			defer func() { wp.workspaces <- workDir }()
+			if failed.Load() {
+				return
+			}
+			if err := job(workDir, idx); err != nil {
+				errs[idx] = err
+				failed.Store(true)
+			}
+		}(workDir, i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package target
+
+import (
+	"errors"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/downloader"
+)
+
+// Status of the analysis of a library version
+type Status string
+
+const (
+	// StatusOK means that the offsets were retrieved from the binary of the version
+	StatusOK Status = "ok"
+	// StatusCacheHit means that all the offsets were found in the existing offsets file
+	StatusCacheHit Status = "cache_hit"
+	// StatusNotAvailable means that the version is not available for the analyzed architecture
+	StatusNotAvailable Status = "not_available"
+	// StatusBuildFailed means that the application wrapping the version can't be built
+	StatusBuildFailed Status = "build_failed"
+	// StatusFieldMissing means that any of the requested fields was not found in the binary
+	StatusFieldMissing Status = "field_missing"
+	// StatusDownloadFailed means that the version or its Go distribution can't be downloaded
+	StatusDownloadFailed Status = "download_failed"
+	// StatusAnalysisFailed means that the binary of the version can't be analyzed
+	StatusAnalysisFailed Status = "analysis_failed"
+)
+
+// Failed returns true if the status is the outcome of an error
+func (s Status) Failed() bool {
+	switch s {
+	case StatusBuildFailed, StatusFieldMissing, StatusDownloadFailed, StatusAnalysisFailed:
+		return true
+	}
+	return false
+}
+
+// statusOf returns the status of an analysis that failed with the provided error. The
+// defaultStatus is returned if the error is not a build failure or a missing field.
+func statusOf(err error, defaultStatus Status) Status {
+	var bf *downloader.ErrBuildFailed
+	if errors.As(err, &bf) {
+		return StatusBuildFailed
+	}
+	var nf *binary.ErrOffsetsNotFound
+	if errors.As(err, &nf) {
+		return StatusFieldMissing
+	}
+	return defaultStatus
+}
+
+// Report of the outcome of the analysis of all the libraries and versions
+type Report struct {
+	Libraries []*LibraryReport `json:"libraries"`
+	// Failures is the number of failed libraries and versions
+	Failures int `json:"failures"`
+}
+
+// LibraryReport contains the outcome of the analysis of each version of a library
+type LibraryReport struct {
+	Name string `json:"name"`
+	// Error is set if the library analysis failed as a whole, e.g. if its versions can't be listed
+	Error    string           `json:"error,omitempty"`
+	Versions []*VersionReport `json:"versions,omitempty"`
+}
+
+type VersionReport struct {
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Status  Status `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// Output of the failed command, if any
+	Output string `json:"output,omitempty"`
+}
+
+// Add the outcome of a library analysis to the report. If err is not nil,
+// the whole library is reported as failed.
+func (r *Report) Add(name string, result *Result, err error) {
+	lr := &LibraryReport{Name: name}
+	r.Libraries = append(r.Libraries, lr)
+	if err != nil {
+		lr.Error = err.Error()
+		r.Failures++
+		return
+	}
+	if result == nil {
+		return
+	}
+	for _, vr := range result.ResultsByVersion {
+		rep := &VersionReport{Version: vr.Version, Arch: vr.Arch, Status: vr.Status}
+		if vr.Err != nil {
+			rep.Error = vr.Err.Error()
+			var bf *downloader.ErrBuildFailed
+			if errors.As(vr.Err, &bf) {
+				rep.Output = bf.Output
+			}
+		}
+		if vr.Status.Failed() {
+			r.Failures++
+		}
+		lr.Versions = append(lr.Versions, rep)
+	}
+}
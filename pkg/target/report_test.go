@@ -0,0 +1,43 @@
+package target
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/downloader"
+)
+
+func TestStatusOf(t *testing.T) {
+	buildErr := &downloader.ErrBuildFailed{Command: "go mod tidy", Output: "missing go.sum entry", Err: errors.New("exit status 1")}
+	assert.Equal(t, StatusBuildFailed, statusOf(fmt.Errorf("wrapped: %w", buildErr), StatusDownloadFailed))
+	assert.Equal(t, StatusFieldMissing, statusOf(fmt.Errorf("wrapped: %w", &binary.ErrOffsetsNotFound{}), StatusAnalysisFailed))
+	assert.Equal(t, StatusDownloadFailed, statusOf(errors.New("connection reset"), StatusDownloadFailed))
+}
+
+func TestReport(t *testing.T) {
+	report := Report{}
+	report.Add("go", &Result{ResultsByVersion: []*VersionedResult{
+		{Version: "1.20.0", Arch: "amd64", Status: StatusOK},
+		{Version: "1.21.0", Arch: "amd64", Status: StatusCacheHit},
+		{Version: "1.21.0", Arch: "arm", Status: StatusNotAvailable},
+	}}, nil)
+	report.Add("google.golang.org/grpc", &Result{ResultsByVersion: []*VersionedResult{
+		{Version: "v1.14.0", Arch: "amd64", Status: StatusBuildFailed, Err: &downloader.ErrBuildFailed{
+			Command: "go mod tidy", Output: "missing go.sum entry", Err: errors.New("exit status 1"),
+		}},
+		{Version: "v1.60.0", Arch: "amd64", Status: StatusOK},
+	}}, nil)
+	report.Add("golang.org/x/net", nil, errors.New("no tags found"))
+
+	assert.Equal(t, 2, report.Failures)
+	assert.Len(t, report.Libraries, 3)
+	failed := report.Libraries[1].Versions[0]
+	assert.Equal(t, StatusBuildFailed, failed.Status)
+	assert.Equal(t, "go mod tidy: exit status 1", failed.Error)
+	assert.Equal(t, "missing go.sum entry", failed.Output)
+	assert.Equal(t, "no tags found", report.Libraries[2].Error)
+}
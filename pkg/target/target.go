@@ -1,9 +1,9 @@
 package target
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"strings"
+	"sync"
 
 	"github.com/grafana/go-offsets-tracker/pkg/offsets"
 
@@ -12,18 +12,29 @@ import (
 	"github.com/grafana/go-offsets-tracker/pkg/binary"
 	"github.com/grafana/go-offsets-tracker/pkg/cache"
 	"github.com/grafana/go-offsets-tracker/pkg/downloader"
+	"github.com/grafana/go-offsets-tracker/pkg/modproxy"
 	"github.com/grafana/go-offsets-tracker/pkg/versions"
 )
 
 type VersionsStrategy int
 type BinaryFetchStrategy int
+type AnalysisStrategy int
 
 const (
 	GoListVersionsStrategy    VersionsStrategy = 0
 	GoDevFileVersionsStrategy VersionsStrategy = 1
+	// ModuleProxyVersionsStrategy lists the versions from the GOPROXY module proxies. Modules
+	// that need to be fetched directly from their repositories are listed with the go command
+	ModuleProxyVersionsStrategy VersionsStrategy = 2
 
 	WrapAsGoAppBinaryFetchStrategy         BinaryFetchStrategy = 0
 	DownloadPreCompiledBinaryFetchStrategy BinaryFetchStrategy = 1
+
+	// LinearAnalysisStrategy downloads and analyzes every version
+	LinearAnalysisStrategy AnalysisStrategy = 0
+	// BisectAnalysisStrategy analyzes only the oldest and newest versions, and bisects
+	// the versions in the middle only where the offsets of any field differ
+	BisectAnalysisStrategy AnalysisStrategy = 1
 )
 
 type Result struct {
@@ -33,15 +44,34 @@ type Result struct {
 
 type VersionedResult struct {
 	Version    string
+	Arch       string
 	OffsetData *binary.Result
+	Status     Status
+	// Err is the error of a failed version, in keep-going mode. OffsetData
+	// then only contains the offsets that were found in the cache.
+	Err error
+}
+
+// analysis groups the parameters of the analysis of a library for a given architecture
+type analysis struct {
+	lib  offsets.LibQuery
+	arch string
+	dm   []*binary.DataMember
 }
 
 type targetData struct {
 	name                string
 	VersionsStrategy    VersionsStrategy
 	BinaryFetchStrategy BinaryFetchStrategy
+	AnalysisStrategy    AnalysisStrategy
+	verify              bool
+	keepGoing           bool
+	workers             *WorkerPool
+	toolchains          *downloader.ToolchainCache
+	journal             *Journal
 	packages            []string
 	branch              string
+	archs               []string
 	versionConstraint   *version.Constraints
 	Cache               *cache.Cache
 }
@@ -51,6 +81,7 @@ func New(name string, fileName string) *targetData {
 		name:                name,
 		VersionsStrategy:    GoListVersionsStrategy,
 		BinaryFetchStrategy: WrapAsGoAppBinaryFetchStrategy,
+		AnalysisStrategy:    LinearAnalysisStrategy,
 		Cache:               cache.NewCache(fileName),
 	}
 }
@@ -70,6 +101,13 @@ func (t *targetData) VersionConstraint(constraint *version.Constraints) *targetD
 	return t
 }
 
+// Architectures sets the GOARCH values of the analyzed binaries. If not set,
+// only the offsets for offsets.DefaultArch are retrieved
+func (t *targetData) Architectures(archs []string) *targetData {
+	t.archs = archs
+	return t
+}
+
 func (t *targetData) FindVersionsBy(strategy VersionsStrategy) *targetData {
 	t.VersionsStrategy = strategy
 	return t
@@ -80,9 +118,62 @@ func (t *targetData) DownloadBinaryBy(strategy BinaryFetchStrategy) *targetData
 	return t
 }
 
+func (t *targetData) AnalyzeBy(strategy AnalysisStrategy) *targetData {
+	t.AnalysisStrategy = strategy
+	return t
+}
+
+// Verify makes the BisectAnalysisStrategy to still analyze every version, reporting
+// the versions whose offsets differ from what the bisection inferred.
+func (t *targetData) Verify(verify bool) *targetData {
+	t.verify = verify
+	return t
+}
+
+// KeepGoing makes the analysis to continue after a version fails to be downloaded, built or
+// analyzed. The failed versions are returned with their Status and error, and the offsets of the
+// rest of versions are returned as usual.
+func (t *targetData) KeepGoing(keepGoing bool) *targetData {
+	t.keepGoing = keepGoing
+	return t
+}
+
+// Journal sets the checkpoint journal where each analyzed version is recorded, and from
+// where the versions recorded by an interrupted run are resumed.
+func (t *targetData) Journal(j *Journal) *targetData {
+	t.journal = j
+	return t
+}
+
+// Workers sets the WorkerPool that will concurrently download and analyze the versions.
+// If not set, the versions are analyzed sequentially.
+func (t *targetData) Workers(pool *WorkerPool) *targetData {
+	t.workers = pool
+	return t
+}
+
+// Toolchains sets the cache of the Go distributions that are downloaded by the
+// DownloadPreCompiledBinaryFetchStrategy. If not set, the distributions are cached in the
+// downloader.DefaultToolchainsDir directory, with the downloader.DefaultToolchainsMaxSize limit.
+func (t *targetData) Toolchains(cache *downloader.ToolchainCache) *targetData {
+	t.toolchains = cache
+	return t
+}
+
 func (t *targetData) FindOffsets(goLib offsets.LibQuery) (*Result, error) {
 
-	dm := fieldsAsDataMembers(goLib.Fields)
+	dm, err := fieldsAsDataMembers(&goLib, goLib.Fields, false)
+	if err != nil {
+		return nil, err
+	}
+	optional, err := fieldsAsDataMembers(&goLib, goLib.Optional, true)
+	if err != nil {
+		return nil, err
+	}
+	dm = append(dm, optional...)
+	if err := addAliases(dm, goLib.Aliases); err != nil {
+		return nil, err
+	}
 
 	var vers []string
 	if t.branch != "" {
@@ -96,106 +187,232 @@ func (t *targetData) FindOffsets(goLib offsets.LibQuery) (*Result, error) {
 		}
 	}
 
-	result := &Result{
-		ModuleName: t.name,
-	}
-	for _, v := range vers {
-		if t.Cache != nil {
-			cachedResults, found := t.Cache.IsAllInCache(v, dm)
-			if found {
-				fmt.Printf("%s: Found all requested offsets in cache for version %s\n", t.name, v)
-				result.ResultsByVersion = append(result.ResultsByVersion, &VersionedResult{
-					Version: v,
-					OffsetData: &binary.Result{
-						DataMembers: cachedResults,
-					},
-				})
-				continue
-			}
-		}
-
-		fmt.Printf("%s: Downloading version %s\n", t.name, v)
-		exePath, dir, err := t.downloadBinary(t.name, goLib.Inspect, v)
+	if t.workers == nil {
+		pool, err := NewWorkerPool(1)
 		if err != nil {
 			return nil, err
 		}
+		defer pool.Close()
+		t.workers = pool
+	}
 
-		fmt.Printf("%s: Analyzing binary for version %s\n", t.name, v)
-		res, err := t.analyzeFile(v, exePath, dm)
+	if t.toolchains == nil && t.BinaryFetchStrategy == DownloadPreCompiledBinaryFetchStrategy {
+		var err error
+		t.toolchains, err = downloader.NewToolchainCache(downloader.DefaultToolchainsDir(), downloader.DefaultToolchainsMaxSize)
 		if err != nil {
-			return nil, fmt.Errorf("%s (version: %s): %w", t.name, v, err)
-		} else {
-			result.ResultsByVersion = append(result.ResultsByVersion, &VersionedResult{
-				Version:    v,
-				OffsetData: res,
-			})
+			return nil, err
 		}
+	}
+
+	archs := t.archs
+	if len(archs) == 0 {
+		archs = []string{offsets.DefaultArch}
+	}
 
-		os.RemoveAll(dir)
+	// architectures are analyzed concurrently, bounded by the workers pool
+	byArch := make([][]*VersionedResult, len(archs))
+	errs := make([]error, len(archs))
+	wg := sync.WaitGroup{}
+	wg.Add(len(archs))
+	for i, arch := range archs {
+		go func(i int, a *analysis) {
+			defer wg.Done()
+			byArch[i], errs[i] = t.analyzeArch(a, vers)
+		}(i, &analysis{lib: goLib, arch: arch, dm: dm})
+	}
+	wg.Wait()
+
+	result := &Result{
+		ModuleName: t.name,
+	}
+	for i := range archs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		result.ResultsByVersion = append(result.ResultsByVersion, byArch[i]...)
 	}
 
 	return result, nil
 }
 
-func parseFieldName(f string) (string, string, string) {
-	if strings.HasPrefix(f, "[") {
-		l := strings.Index(f, "]")
+func (t *targetData) analyzeArch(a *analysis, vers []string) ([]*VersionedResult, error) {
+	switch t.AnalysisStrategy {
+	case LinearAnalysisStrategy:
+		return t.analyzeVersions(a, vers)
+	case BisectAnalysisStrategy:
+		return t.bisect(a, vers)
+	default:
+		return nil, fmt.Errorf("unsupported analysis strategy")
+	}
+}
+
+// analyzeVersions analyzes concurrently the provided versions. The returned results
+// follow the same order as the versions.
+func (t *targetData) analyzeVersions(a *analysis, vers []string) ([]*VersionedResult, error) {
+	results := make([]*VersionedResult, len(vers))
+	err := t.workers.run(len(vers), func(workDir string, idx int) error {
+		vr, err := t.analyzeVersion(workDir, a, vers[idx])
+		results[idx] = vr
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
 
-		if l > 0 {
-			versionsStr := f[1:l]
+// analyzeVersion returns the offsets of the provided data members for a given version, from the
+// cache if available. The missing data members are retrieved by downloading and analyzing the binary
+// for that version, and merged with the cached ones.
+// If the version is not available for the analyzed architecture, it only returns the cached offsets.
+func (t *targetData) analyzeVersion(workDir string, a *analysis, v string) (*VersionedResult, error) {
+	vr := &VersionedResult{Version: v, Arch: a.arch, OffsetData: &binary.Result{}}
+	missing := a.dm
+	if t.Cache != nil {
+		vr.OffsetData.DataMembers, missing = t.Cache.Find(t.name, v, a.arch, a.dm)
+		if len(missing) == 0 {
+			fmt.Printf("%s: Found all requested offsets in cache for version %s (%s)\n", t.name, v, a.arch)
+			vr.Status = StatusCacheHit
+			return vr, nil
+		}
+		if len(vr.OffsetData.DataMembers) > 0 {
+			fmt.Printf("%s: Found %d of %d requested offsets in cache for version %s (%s)\n",
+				t.name, len(vr.OffsetData.DataMembers), len(vr.OffsetData.DataMembers)+len(missing), v, a.arch)
+		}
+	}
 
-			if len(versionsStr) > 0 {
-				versions := strings.Split(versionsStr, ",")
+	if resumed := t.journal.find(t.name, v, a.arch, missing); resumed != nil {
+		fmt.Printf("%s: Resuming version %s (%s) from journal\n", t.name, v, a.arch)
+		resumed.OffsetData.DataMembers = append(vr.OffsetData.DataMembers, resumed.OffsetData.DataMembers...)
+		return resumed, nil
+	}
 
-				if len(versions) > 0 {
-					if len(versions) > 1 {
-						return f[l+1:], versions[0], versions[1]
-					} else {
-						return f[l+1:], versions[0], ""
-					}
-				}
-			}
+	fmt.Printf("%s: Downloading version %s (%s)\n", t.name, v, a.arch)
+	exePath, dir, err := t.downloadBinary(workDir, t.name, a.lib.Inspect, v, a.arch)
+	if err != nil {
+		var na *downloader.ErrNotAvailable
+		if errors.As(err, &na) {
+			fmt.Printf("%s: version %s is not available for %s. Skipping\n", t.name, v, a.arch)
+			vr.Status = StatusNotAvailable
+			t.record(vr)
+			return vr, nil
 		}
+		return t.failed(vr, statusOf(err, StatusDownloadFailed), err)
+	}
+	defer downloader.RemoveTempDir(dir)
+
+	fmt.Printf("%s: Analyzing binary for version %s (%s)\n", t.name, v, a.arch)
+	res, err := t.analyzeFile(v, exePath, missing)
+	if err != nil {
+		err = fmt.Errorf("%s (version: %s, arch: %s): %w", t.name, v, a.arch, err)
+		return t.failed(vr, statusOf(err, StatusAnalysisFailed), err)
+	}
+	vr.OffsetData.DataMembers = append(vr.OffsetData.DataMembers, res.DataMembers...)
+	vr.Status = StatusOK
+	t.record(vr)
+	return vr, nil
+}
+
+// record appends the result of a version to the journal, if any
+func (t *targetData) record(vr *VersionedResult) {
+	if err := t.journal.record(t.name, vr); err != nil {
+		fmt.Printf("%s: WARNING: can't record version %s (%s) in the journal: %v\n", t.name, vr.Version, vr.Arch, err)
 	}
+}
 
-	return f, "", ""
+// failed returns the error of a version analysis, aborting the whole analysis. In keep-going mode,
+// it instead records the error and the status in the versioned result, so the analysis continues.
+func (t *targetData) failed(vr *VersionedResult, status Status, err error) (*VersionedResult, error) {
+	if !t.keepGoing {
+		return nil, err
+	}
+	fmt.Printf("%s: WARNING: version %s (%s) failed: %s: %v\n", t.name, vr.Version, vr.Arch, status, err)
+	vr.Status, vr.Err = status, err
+	return vr, nil
 }
 
 // Function kept to keep interfaces' and types compatibility with old version
 // TODO: remove DataMember type and use the simple map form
-func fieldsAsDataMembers(fields map[string][]string) []*binary.DataMember {
+func fieldsAsDataMembers(lib *offsets.LibQuery, fields map[string][]string, optional bool) ([]*binary.DataMember, error) {
 	var out []*binary.DataMember
 
 	for structName, fieldsList := range fields {
 		for _, fieldName := range fieldsList {
-			field, minVer, maxVer := parseFieldName(fieldName)
+			field, constraints, err := lib.FieldConstraints(structName, fieldName)
+			if err != nil {
+				return nil, err
+			}
 
 			out = append(out, &binary.DataMember{
 				StructName: structName,
 				Field:      field,
-				MinVersion: minVer,
-				MaxVersion: maxVer,
+				Versions:   constraints,
+				Optional:   optional,
+			})
+		}
+	}
+	return out, nil
+}
+
+// addAliases annotates the data members with the physical names of their structs and fields, for
+// the versions where they differ from the logical names
+func addAliases(dms []*binary.DataMember, aliases map[string][]offsets.Alias) error {
+	for _, dm := range dms {
+		for _, alias := range aliases[dm.StructName] {
+			constraints, err := version.NewConstraint(alias.Versions)
+			if err != nil {
+				return fmt.Errorf("invalid versions constraint %q in the aliases of %s: %w",
+					alias.Versions, dm.StructName, err)
+			}
+			dm.Aliases = append(dm.Aliases, binary.Alias{
+				Versions:   constraints,
+				StructName: alias.Struct,
+				Field:      alias.Fields[dm.Field],
 			})
 		}
 	}
-	return out
+	return nil
 }
 
 func (t *targetData) analyzeFile(version, exePath string, dm []*binary.DataMember) (*binary.Result, error) {
-	f, err := os.Open(exePath)
+	f, err := binary.Open(exePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	res, err := binary.FindOffsets(version, f, dm)
+	res, err := f.FindOffsets(version, dm)
 	if err != nil {
 		return nil, err
 	}
 
+	// binaries built before Go 1.13 do not contain build info, but they
+	// can't either link any dependency module
+	if bi, err := f.BuildInfo(); err == nil {
+		t.annotateDependencies(res, offsets.LinkedModules(bi))
+	}
+
 	return res, nil
 }
 
+// annotateDependencies annotates the data members whose struct belongs to another module than the
+// analyzed library with that module and the version that was linked into the analyzed binary,
+// as the struct layouts depend on it
+func (t *targetData) annotateDependencies(res *binary.Result, linked map[string]string) {
+	modules := make([]string, 0, len(linked))
+	for mod := range linked {
+		modules = append(modules, mod)
+	}
+	for _, dmo := range res.DataMembers {
+		module := offsets.ModuleOf(offsets.StructPackage(dmo.StructName), modules)
+		if module == "" || module == offsets.GoStdLib || module == t.name || linked[module] == "" {
+			continue
+		}
+		dmo.Module = module
+		dmo.ModuleVersion = versions.OrZero(linked[module]).String()
+	}
+}
+
 func (t *targetData) findVersions() ([]string, error) {
 	var vers []string
 	var err error
@@ -209,6 +426,11 @@ func (t *targetData) findVersions() ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+	} else if t.VersionsStrategy == ModuleProxyVersionsStrategy {
+		vers, err = t.findVersionsFromProxy()
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		return nil, fmt.Errorf("unsupported version strategy")
 	}
@@ -235,11 +457,27 @@ func (t *targetData) findVersions() ([]string, error) {
 	return filteredVers, nil
 }
 
-func (t *targetData) downloadBinary(modName, inspectFile, version string) (string, string, error) {
+func (t *targetData) findVersionsFromProxy() ([]string, error) {
+	client, err := modproxy.NewClient(modproxy.ConfigFromEnv())
+	if err != nil {
+		return nil, err
+	}
+	vers, err := client.Versions(t.name)
+	// the go command can still list the versions from the module repository or its own proxy
+	// and checksum database settings (e.g. the private modules that are missing in GONOSUMDB)
+	if errors.Is(err, modproxy.ErrDirect) || errors.Is(err, modproxy.ErrDisabled) ||
+		errors.Is(err, modproxy.ErrVerification) {
+		fmt.Printf("%s: can't list versions from the proxy (%v). Listing versions with the go command\n", t.name, err)
+		return versions.FindVersionsUsingGoList(t.name)
+	}
+	return vers, err
+}
+
+func (t *targetData) downloadBinary(workDir, modName, inspectFile, version, goarch string) (string, string, error) {
 	if t.BinaryFetchStrategy == WrapAsGoAppBinaryFetchStrategy {
-		return downloader.DownloadBinary(modName, version, inspectFile, t.packages)
+		return downloader.DownloadBinary(workDir, modName, version, goarch, inspectFile, t.packages)
 	} else if t.BinaryFetchStrategy == DownloadPreCompiledBinaryFetchStrategy {
-		return downloader.DownloadBinaryFromRemote(inspectFile, version)
+		return downloader.DownloadBinaryFromRemote(workDir, inspectFile, version, goarch, t.toolchains)
 	}
 
 	return "", "", fmt.Errorf("unsupported binary fetch strategy")
@@ -0,0 +1,68 @@
+package target
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+func TestAnnotateDependencies(t *testing.T) {
+	dmo := func(structName string) *binary.DataMemberOffset {
+		return &binary.DataMemberOffset{DataMember: &binary.DataMember{StructName: structName, Field: "f"}}
+	}
+	res := &binary.Result{DataMembers: []*binary.DataMemberOffset{
+		dmo("google.golang.org/grpc/internal/transport.Stream"),
+		dmo("golang.org/x/net/http2.FrameHeader"),
+		dmo("net/http.Request"),
+	}}
+	td := New("google.golang.org/grpc", "")
+	td.annotateDependencies(res, map[string]string{
+		"testapp":                "(devel)",
+		"google.golang.org/grpc": "v1.54.0",
+		"golang.org/x/net":       "v0.8.0",
+	})
+
+	assert.Empty(t, res.DataMembers[0].Module)
+	assert.Equal(t, "golang.org/x/net", res.DataMembers[1].Module)
+	assert.Equal(t, "0.8.0", res.DataMembers[1].ModuleVersion)
+	assert.Empty(t, res.DataMembers[2].Module)
+}
+
+func TestAddAliases(t *testing.T) {
+	dms, err := fieldsAsDataMembers(&offsets.LibQuery{}, map[string][]string{"runtime.hmap": {"count"}}, false)
+	require.NoError(t, err)
+	require.NoError(t, addAliases(dms, map[string][]offsets.Alias{
+		"runtime.hmap":     {{Versions: ">= 1.24", Struct: "internal/runtime/maps.Map", Fields: map[string]string{"count": "used"}}},
+		"net/http.Request": {{Versions: ">= 1.0", Struct: "net/http.Other"}},
+	}))
+	require.Len(t, dms, 1)
+	require.Len(t, dms[0].Aliases, 1)
+	assert.Equal(t, "internal/runtime/maps.Map", dms[0].Aliases[0].StructName)
+	assert.Equal(t, "used", dms[0].Aliases[0].Field)
+	assert.Equal(t, ">= 1.24", dms[0].Aliases[0].Versions.String())
+
+	assert.Error(t, addAliases(dms, map[string][]offsets.Alias{"runtime.hmap": {{Versions: "invalid"}}}))
+}
+
+func TestFieldsAsDataMembers_Versions(t *testing.T) {
+	lib := &offsets.LibQuery{
+		StructVersions: map[string]string{"net/http.Request": ">= 1.12"},
+		FieldVersions:  map[string]map[string]string{"net/http.Request": {"Pattern": "< 1.23"}},
+	}
+	dms, err := fieldsAsDataMembers(lib, map[string][]string{"net/http.Request": {"[1.14,1.22]Pattern"}}, false)
+	require.NoError(t, err)
+	require.Len(t, dms, 1)
+	assert.Equal(t, "Pattern", dms[0].Field)
+	assert.Equal(t, ">= 1.12, < 1.23, >= 1.14, <= 1.22", dms[0].Versions.String())
+	// both the min and the max of the prefix are applied
+	assert.False(t, dms[0].AppliesTo("1.13.0"))
+	assert.True(t, dms[0].AppliesTo("1.14.0"))
+	assert.True(t, dms[0].AppliesTo("v1.22.0"))
+	assert.False(t, dms[0].AppliesTo("1.23.0"))
+	// branches are not constrained
+	assert.True(t, dms[0].AppliesTo("main"))
+}
@@ -2,20 +2,47 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"os"
 	"os/exec"
+	"strings"
+	"time"
 )
 
-const ShellToUse = "bash"
+// Command to run. The program and its arguments are passed to the operating system as they are,
+// without any shell interpretation, so they can safely contain user-provided values.
+type Command struct {
+	// Name of the program, looked up in the PATH if it does not contain any path separator
+	Name string
+	Args []string
+	// Env contains the environment variables, in KEY=value form, that are added to the
+	// environment of the current process
+	Env []string
+	// Dir is the working directory. If empty, the current directory is used
+	Dir string
+}
 
-func RunCommand(command string, dir string) (string, error) {
-	var output bytes.Buffer
-	cmd := exec.Command(ShellToUse, "-c", command)
-	if dir != "" {
-		cmd.Dir = dir
+// Run the command and returns its standard output and standard error. If the context is canceled
+// or its deadline expires, the command is killed.
+func (c *Command) Run(ctx context.Context) (stdout string, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	// children processes might keep the output pipes open after the command is killed
+	cmd.WaitDelay = 5 * time.Second
+	err = cmd.Run()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		err = ctxErr
 	}
+	return outBuf.String(), errBuf.String(), err
+}
 
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-	err := cmd.Run()
-	return output.String(), err
+// String returns the command line, for logging purposes
+func (c *Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
 }
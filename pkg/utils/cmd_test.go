@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand_Run(t *testing.T) {
+	// arguments are not interpreted by any shell
+	cmd := Command{Name: "echo", Args: []string{"$HOME", "; echo injected"}}
+	stdout, stderr, err := cmd.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "$HOME ; echo injected\n", stdout)
+	assert.Empty(t, stderr)
+
+	cmd = Command{Name: "sh", Args: []string{"-c", `echo "out $MY_VAR"; echo err >&2; exit 3`}, Env: []string{"MY_VAR=value"}}
+	stdout, stderr, err = cmd.Run(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, "out value\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+	assert.Equal(t, `sh -c echo "out $MY_VAR"; echo err >&2; exit 3`, cmd.String())
+}
+
+func TestCommand_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := (&Command{Name: "sleep", Args: []string{"10"}}).Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,178 @@
+// Package verify checks the offsets of a Track against the executables they apply to
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// Status of the verification of a tracked field
+type Status string
+
+const (
+	// StatusOK means that the tracked offset matches the offset in the executable,
+	// or that the field is tracked as absent and the executable does not contain it
+	StatusOK Status = "ok"
+	// StatusMismatch means that the tracked offset is different from the offset in the executable,
+	// or that the field is tracked as absent but the executable contains it
+	StatusMismatch Status = "mismatch"
+	// StatusUntracked means that the version of the module that contains the struct is not tracked
+	StatusUntracked Status = "untracked"
+	// StatusMissing means that the executable contains the struct, but not the tracked field
+	StatusMissing Status = "missing"
+	// StatusNotLinked means that the executable does not contain the struct, so it can't be verified
+	StatusNotLinked Status = "not_linked"
+)
+
+// Failed returns whether the status means that the tracked offsets are wrong or out of date
+func (s Status) Failed() bool {
+	return s == StatusMismatch || s == StatusUntracked || s == StatusMissing
+}
+
+// Report contains the verification of all the tracked fields that apply to an executable
+type Report struct {
+	Executable string `json:"executable"`
+	GoVersion  string `json:"go_version"`
+	Arch       string `json:"arch"`
+	// Fields sorted by struct and field name
+	Fields []FieldReport `json:"fields"`
+	// Failures is the number of fields whose status is failed
+	Failures int `json:"failures"`
+}
+
+// FieldReport is the verification of a tracked field
+type FieldReport struct {
+	Struct string `json:"struct"`
+	Field  string `json:"field"`
+	// Module that contains the struct, or offsets.GoStdLib, and its version in the executable
+	Module  string `json:"module"`
+	Version string `json:"version"`
+	Status  Status `json:"status"`
+	// Tracked offset, if the field is tracked as present in the version
+	Tracked *uint64 `json:"tracked,omitempty"`
+	// Found offset in the executable, if it contains the field
+	Found *uint64 `json:"found,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Executable verifies the offsets of the Track that apply to an executable, according to the
+// versions of the Go standard library and the modules in its build information, against the
+// offsets that are read from the executable itself. The fields of the structs with aliases, as
+// returned by offsets.InputLibs.Aliases, are read by their names in the executable
+func Executable(track *offsets.Track, path string, aliases map[string][]offsets.Alias) (*Report, error) {
+	res, err := track.ResolveExecutable(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := binary.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening executable: %w", err)
+	}
+	defer f.Close()
+
+	report := &Report{Executable: path, GoVersion: res.GoVersion, Arch: res.Arch}
+	modules := make([]string, 0, len(res.Modules))
+	for mod := range res.Modules {
+		modules = append(modules, mod)
+	}
+	for structName, strct := range track.Data {
+		module := offsets.ModuleOf(offsets.StructPackage(structName), modules)
+		if module == "" {
+			// the module of the struct is not linked into the executable
+			continue
+		}
+		modVersion := res.GoVersion
+		if module != offsets.GoStdLib {
+			modVersion = res.Modules[module]
+		}
+		for fieldName := range strct {
+			dm, err := dataMember(structName, fieldName, aliases[structName])
+			if err != nil {
+				return nil, err
+			}
+			fr := verifyField(f, track, res.Arch, dm, modVersion)
+			fr.Module = module
+			if fr.Status.Failed() {
+				report.Failures++
+			}
+			report.Fields = append(report.Fields, fr)
+		}
+	}
+	sort.Slice(report.Fields, func(i, j int) bool {
+		if report.Fields[i].Struct != report.Fields[j].Struct {
+			return report.Fields[i].Struct < report.Fields[j].Struct
+		}
+		return report.Fields[i].Field < report.Fields[j].Field
+	})
+	return report, nil
+}
+
+// dataMember returns the data member of a tracked field, with the names that it has in the
+// executables according to the aliases of its struct
+func dataMember(structName, fieldName string, aliases []offsets.Alias) (*binary.DataMember, error) {
+	dm := &binary.DataMember{StructName: structName, Field: fieldName}
+	for _, alias := range aliases {
+		constraints, err := version.NewConstraint(alias.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid versions constraint %q in the aliases of %s: %w",
+				alias.Versions, structName, err)
+		}
+		dm.Aliases = append(dm.Aliases, binary.Alias{
+			Versions:   constraints,
+			StructName: alias.Struct,
+			Field:      alias.Fields[fieldName],
+		})
+	}
+	return dm, nil
+}
+
+func verifyField(f *binary.File, track *offsets.Track, arch string, dm *binary.DataMember, modVersion string) FieldReport {
+	structName, fieldName := dm.StructName, dm.Field
+	fr := FieldReport{Struct: structName, Field: fieldName, Version: modVersion}
+	// versions like "(devel)" can't be compared with the tracked versions, and suffixes like
+	// " X:boringcrypto" are ignored
+	presence := offsets.NotTracked
+	cleanVersion := versions.CleanVersion(modVersion)
+	if _, err := version.NewVersion(cleanVersion); err == nil {
+		var tracked uint64
+		tracked, presence = track.FindPresence(arch, structName, fieldName, cleanVersion)
+		if presence == offsets.Present {
+			fr.Tracked = &tracked
+		}
+	}
+
+	found, err := f.FindOffsets(cleanVersion, []*binary.DataMember{dm})
+	var snf *binary.ErrStructNotFound
+	var fnf *binary.ErrFieldNotFound
+	switch {
+	case err == nil:
+		fr.Found = &found.DataMembers[0].Offset
+	case errors.As(err, &snf):
+		fr.Status = StatusNotLinked
+		return fr
+	case !errors.As(err, &fnf):
+		fr.Status, fr.Error = StatusMismatch, err.Error()
+		return fr
+	}
+
+	switch {
+	case presence == offsets.NotTracked:
+		fr.Status = StatusUntracked
+	case fr.Found == nil && presence == offsets.Absent:
+		fr.Status = StatusOK
+	case fr.Found == nil:
+		fr.Status = StatusMissing
+	case presence == offsets.Absent || *fr.Tracked != *fr.Found:
+		fr.Status = StatusMismatch
+	default:
+		fr.Status = StatusOK
+	}
+	return fr
+}
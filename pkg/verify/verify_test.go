@@ -0,0 +1,115 @@
+package verify
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+func buildExecutable(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("skipping test that builds Go executables")
+	}
+	exe := filepath.Join(t.TempDir(), "prog")
+	cmd := exec.Command("go", "build", "-o", exe, "../binary/testdata/runtimetypes")
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return exe
+}
+
+func TestExecutable(t *testing.T) {
+	exe := buildExecutable(t)
+
+	since := func(offset uint64) offsets.Field {
+		return offsets.Field{Offsets: []offsets.Versioned{{Since: "1.0.0", Offset: offset}}}
+	}
+	track := &offsets.Track{Data: map[string]offsets.Struct{
+		"main.outer": {
+			"Ref":     since(32),
+			"Flag":    since(4),
+			"Unknown": since(8),
+			"Gone":    {Offsets: []offsets.Versioned{{Since: "1.0.0", Absent: true}}},
+			"Tags":    {Offsets: []offsets.Versioned{{Since: "1.0.0", Absent: true}}},
+			"Attrs":   {Offsets: []offsets.Versioned{{Since: "999.0.0", Offset: 64}}},
+		},
+		"main.unused":                    {"ID": since(0)},
+		"github.com/some/unlinked.Thing": {"ID": since(0)},
+	}}
+
+	report, err := Executable(track, exe, nil)
+	require.NoError(t, err)
+	assert.Equal(t, exe, report.Executable)
+	assert.Equal(t, "amd64", report.Arch)
+	assert.NotEmpty(t, report.GoVersion)
+
+	statuses := map[string]Status{}
+	for _, fr := range report.Fields {
+		assert.Equal(t, offsets.GoStdLib, fr.Module)
+		assert.Equal(t, report.GoVersion, fr.Version)
+		statuses[fr.Struct+"."+fr.Field] = fr.Status
+	}
+	assert.Equal(t, map[string]Status{
+		"main.outer.Attrs":   StatusUntracked,
+		"main.outer.Flag":    StatusMismatch,
+		"main.outer.Gone":    StatusOK,
+		"main.outer.Ref":     StatusOK,
+		"main.outer.Tags":    StatusMismatch,
+		"main.outer.Unknown": StatusMissing,
+		"main.unused.ID":     StatusNotLinked,
+	}, statuses)
+	assert.Equal(t, 4, report.Failures)
+
+	require.Equal(t, "Flag", report.Fields[1].Field)
+	require.NotNil(t, report.Fields[1].Tracked)
+	require.NotNil(t, report.Fields[1].Found)
+	assert.EqualValues(t, 4, *report.Fields[1].Tracked)
+	assert.EqualValues(t, 0, *report.Fields[1].Found)
+}
+
+func TestVerifyField_ExperimentSuffix(t *testing.T) {
+	f, err := binary.Open(buildExecutable(t))
+	require.NoError(t, err)
+	defer f.Close()
+	track := &offsets.Track{Data: map[string]offsets.Struct{
+		"main.outer": {"Flag": {Offsets: []offsets.Versioned{{Since: "1.0.0", Offset: 0}}}},
+	}}
+
+	// the versions of toolchains built with GOEXPERIMENT are compared without the experiments
+	dm := &binary.DataMember{StructName: "main.outer", Field: "Flag"}
+	fr := verifyField(f, track, "amd64", dm, "1.22.0 X:boringcrypto")
+	assert.Equal(t, StatusOK, fr.Status)
+	assert.Equal(t, "1.22.0 X:boringcrypto", fr.Version)
+	fr = verifyField(f, track, "amd64", dm, "(devel)")
+	assert.Equal(t, StatusUntracked, fr.Status)
+}
+
+func TestExecutable_Aliases(t *testing.T) {
+	exe := buildExecutable(t)
+	track := &offsets.Track{Data: map[string]offsets.Struct{
+		"main.renamed": {"Reference": {Offsets: []offsets.Versioned{{Since: "1.0.0", Offset: 32}}}},
+	}}
+
+	// the logical names are not part of the executable
+	report, err := Executable(track, exe, nil)
+	require.NoError(t, err)
+	require.Len(t, report.Fields, 1)
+	assert.Equal(t, StatusNotLinked, report.Fields[0].Status)
+
+	report, err = Executable(track, exe, map[string][]offsets.Alias{
+		"main.renamed": {{Versions: ">= 1.0", Struct: "main.outer", Fields: map[string]string{"Reference": "Ref"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Fields, 1)
+	assert.Equal(t, "main.renamed", report.Fields[0].Struct)
+	assert.Equal(t, "Reference", report.Fields[0].Field)
+	assert.Equal(t, StatusOK, report.Fields[0].Status)
+	assert.Zero(t, report.Failures)
+}
@@ -1,24 +1,39 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
+
+	"golang.org/x/mod/module"
 
 	"github.com/grafana/go-offsets-tracker/pkg/utils"
 )
 
+// goListTimeout is the maximum duration of the go list command, which queries the module proxy
+// or the repository of the module
+const goListTimeout = 5 * time.Minute
+
 type goListResponse struct {
 	Path     string   `json:"Path"`
 	Versions []string `json:"versions"`
 }
 
 func FindVersionsUsingGoList(moduleName string) ([]string, error) {
-	stdout, err := utils.RunCommand(fmt.Sprintf("go list -m -mod=readonly -json -versions %s", moduleName), "")
-	if err != nil {
-		log.Println("error running go list:\n", stdout)
+	// the module name is passed as an argument, so it must not be taken as a go list flag
+	if err := module.CheckPath(moduleName); err != nil {
 		return nil, err
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), goListTimeout)
+	defer cancel()
+	cmd := utils.Command{Name: "go", Args: []string{"list", "-m", "-mod=readonly", "-json", "-versions", moduleName}}
+	stdout, stderr, err := cmd.Run(ctx)
+	if err != nil {
+		log.Println("error running go list:\n", stderr)
+		return nil, fmt.Errorf("%s: %w", cmd.String(), err)
+	}
 
 	resp := goListResponse{}
 	err = json.Unmarshal([]byte(stdout), &resp)
@@ -5,18 +5,71 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 )
 
-const (
-	jsonUrl = "https://go.dev/dl/?mode=json&include=all"
+// jsonUrl lists all the Go releases and the checksums of their files
+var jsonUrl = "https://go.dev/dl/?mode=json&include=all"
+
+var (
+	releasesMu sync.Mutex
+	// releases is the last successful response of jsonUrl
+	releases []goDevResponse
 )
 
 type goDevResponse struct {
-	Version string `json:"version"`
-	Stable  bool   `json:"stable"`
+	Version string      `json:"version"`
+	Stable  bool        `json:"stable"`
+	Files   []goDevFile `json:"files"`
+}
+
+type goDevFile struct {
+	Filename string `json:"filename"`
+	Sha256   string `json:"sha256"`
 }
 
 func FindVersionsFromGoWebsite() ([]string, error) {
+	resp, err := fetchGoReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, v := range resp {
+		if v.Stable {
+			stripepdV := strings.ReplaceAll(v.Version, "go", "")
+			versions = append(versions, stripepdV)
+		}
+	}
+
+	return versions, nil
+}
+
+// FindGoChecksums returns the SHA256 checksums of the files of all the Go releases, as published
+// in the go.dev website. The key is the file name (e.g. go1.21.0.linux-amd64.tar.gz)
+func FindGoChecksums() (map[string]string, error) {
+	resp, err := fetchGoReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := map[string]string{}
+	for _, v := range resp {
+		for _, f := range v.Files {
+			checksums[f.Filename] = f.Sha256
+		}
+	}
+	return checksums, nil
+}
+
+// fetchGoReleases returns the Go releases that are published in the go.dev website. The response is
+// fetched once and reused, so the versions and their checksums are listed with a single request
+func fetchGoReleases() ([]goDevResponse, error) {
+	releasesMu.Lock()
+	defer releasesMu.Unlock()
+	if releases != nil {
+		return releases, nil
+	}
 	res, err := http.Get(jsonUrl)
 	if err != nil {
 		return nil, err
@@ -33,14 +86,6 @@ func FindVersionsFromGoWebsite() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	var versions []string
-	for _, v := range resp {
-		if v.Stable {
-			stripepdV := strings.ReplaceAll(v.Version, "go", "")
-			versions = append(versions, stripepdV)
-		}
-	}
-
-	return versions, nil
+	releases = resp
+	return resp, nil
 }
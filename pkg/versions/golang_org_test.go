@@ -0,0 +1,35 @@
+package versions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchGoReleases_Reused(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`[
+			{"version": "go1.21.0", "stable": true, "files": [{"filename": "go1.21.0.linux-amd64.tar.gz", "sha256": "abcd"}]},
+			{"version": "go1.22rc1", "stable": false, "files": []}
+		]`))
+	}))
+	defer server.Close()
+	defaultURL := jsonUrl
+	jsonUrl = server.URL
+	releases = nil
+	defer func() { jsonUrl, releases = defaultURL, nil }()
+
+	vers, err := FindVersionsFromGoWebsite()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.21.0"}, vers)
+	checksums, err := FindGoChecksums()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"go1.21.0.linux-amd64.tar.gz": "abcd"}, checksums)
+	assert.EqualValues(t, 1, requests.Load())
+}
@@ -0,0 +1,215 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+	"github.com/grafana/go-offsets-tracker/pkg/versions"
+)
+
+// WriteTable writes the offsets of the Track into a file in the table format, as described in offsets.Table
+func WriteTable(fileName string, track *offsets.Track) error {
+	data, err := EncodeTable(track)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0o644)
+}
+
+// EncodeTable returns the offsets of the Track in the table format, as described in offsets.Table
+func EncodeTable(track *offsets.Track) ([]byte, error) {
+	enc := tableEncoder{refs: map[string]uint32{}, archIdx: map[string]int{}}
+
+	structNames := make([]string, 0, len(track.Data))
+	for name := range track.Data {
+		structNames = append(structNames, name)
+	}
+	sort.Strings(structNames)
+	var numFields int
+	for _, structName := range structNames {
+		strct := track.Data[structName]
+		fieldNames := make([]string, 0, len(strct))
+		for name := range strct {
+			fieldNames = append(fieldNames, name)
+		}
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			if err := enc.field(structName, fieldName, fieldIntervals(track, structName, strct[fieldName])); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", structName, fieldName, err)
+			}
+			numFields++
+		}
+	}
+	if len(enc.archs) > math.MaxUint8+1 {
+		return nil, fmt.Errorf("too many architectures: %d", len(enc.archs))
+	}
+
+	out := bytes.Buffer{}
+	header := make([]byte, offsets.TableHeaderSize)
+	copy(header, offsets.TableMagic)
+	binary.LittleEndian.PutUint16(header[4:], offsets.TableFormatVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(enc.archs)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(numFields))
+	binary.LittleEndian.PutUint32(header[16:], uint32(enc.intervals.Len()/offsets.TableIntervalSize))
+	binary.LittleEndian.PutUint32(header[20:], uint32(enc.strings.Len()))
+	out.Write(header)
+	out.Write(enc.fields.Bytes())
+	out.Write(enc.intervals.Bytes())
+	for _, ref := range enc.archs {
+		out.Write(binary.LittleEndian.AppendUint32(nil, ref))
+	}
+	out.Write(enc.strings.Bytes())
+	return out.Bytes(), nil
+}
+
+type tableEncoder struct {
+	fields    bytes.Buffer
+	intervals bytes.Buffer
+	strings   bytes.Buffer
+	// refs key: string, value: its position in the strings section
+	refs map[string]uint32
+	// archs contains the string references of the architectures, by index
+	archs   []uint32
+	archIdx map[string]int
+}
+
+// tableInterval is an entry of a field together with the size of its struct
+type tableInterval struct {
+	od         offsets.Versioned
+	structSize uint64
+}
+
+// fieldIntervals returns the entries of a field with the size of its struct, sorted from older to newer
+// version. The entries are split at the versions where the struct size changes, so the struct size of
+// each interval applies to all its versions
+func fieldIntervals(track *offsets.Track, structName string, field offsets.Field) []tableInterval {
+	archs := map[string][]string{}
+	oldest := map[string]*version.Version{}
+	for _, od := range field.Offsets {
+		arch := offsets.ArchOrDefault(od.Arch)
+		archs[arch] = append(archs[arch], od.Since)
+		if since := versions.MustParse(od.Since); oldest[arch] == nil || since.LessThan(oldest[arch]) {
+			oldest[arch] = since
+		}
+	}
+	var intervals []tableInterval
+	for arch, sinces := range archs {
+		// the sizes of the versions before the field was tracked are ignored
+		for _, vs := range track.Structs[structName].Sizes {
+			if offsets.ArchOrDefault(vs.Arch) == arch && !versions.MustParse(vs.Since).LessThan(oldest[arch]) {
+				sinces = append(sinces, vs.Since)
+			}
+		}
+		sort.SliceStable(sinces, func(i, j int) bool {
+			return versions.MustParse(sinces[i]).LessThan(versions.MustParse(sinces[j]))
+		})
+		var last *tableInterval
+		for _, since := range sinces {
+			od, ok := field.Get(arch, since)
+			if !ok {
+				continue
+			}
+			size, _ := track.StructSize(arch, structName, since)
+			if last != nil && last.structSize == size && sameValue(&last.od, od) {
+				continue
+			}
+			intervals = append(intervals, tableInterval{od: *od, structSize: size})
+			intervals[len(intervals)-1].od.Since = since
+			last = &intervals[len(intervals)-1]
+		}
+	}
+	sort.SliceStable(intervals, func(i, j int) bool {
+		if intervals[i].od.Since == intervals[j].od.Since {
+			return offsets.ArchOrDefault(intervals[i].od.Arch) < offsets.ArchOrDefault(intervals[j].od.Arch)
+		}
+		return versions.MustParse(intervals[i].od.Since).LessThan(versions.MustParse(intervals[j].od.Since))
+	})
+	return intervals
+}
+
+// field appends the record of a field and the records of its intervals, which must be sorted
+// from older to newer version
+func (enc *tableEncoder) field(structName, fieldName string, sorted []tableInterval) error {
+	rec := make([]byte, offsets.TableFieldSize)
+	structRef, err := enc.string(structName)
+	if err != nil {
+		return err
+	}
+	fieldRef, err := enc.string(fieldName)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(rec, structRef)
+	binary.LittleEndian.PutUint32(rec[4:], fieldRef)
+	binary.LittleEndian.PutUint32(rec[8:], uint32(enc.intervals.Len()/offsets.TableIntervalSize))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(sorted)))
+	enc.fields.Write(rec)
+
+	for i := range sorted {
+		if err := enc.interval(&sorted[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *tableEncoder) interval(iv *tableInterval) error {
+	od := &iv.od
+	since, pre, err := offsets.TableVersion(od.Since)
+	if err != nil {
+		return err
+	}
+	if od.Size > math.MaxUint32 || iv.structSize > math.MaxUint32 {
+		return fmt.Errorf("size too large for version %s", od.Since)
+	}
+	preRef, err := enc.string(pre)
+	if err != nil {
+		return err
+	}
+	arch := offsets.ArchOrDefault(od.Arch)
+	idx, ok := enc.archIdx[arch]
+	if !ok {
+		ref, err := enc.string(arch)
+		if err != nil {
+			return err
+		}
+		idx = len(enc.archs)
+		enc.archIdx[arch] = idx
+		enc.archs = append(enc.archs, ref)
+	}
+	rec := make([]byte, offsets.TableIntervalSize)
+	binary.LittleEndian.PutUint64(rec, since)
+	binary.LittleEndian.PutUint64(rec[8:], od.Offset)
+	binary.LittleEndian.PutUint32(rec[16:], uint32(od.Size))
+	binary.LittleEndian.PutUint32(rec[20:], uint32(iv.structSize))
+	binary.LittleEndian.PutUint32(rec[24:], preRef)
+	binary.LittleEndian.PutUint16(rec[28:], uint16(len(pre)))
+	rec[30] = uint8(idx)
+	if od.Absent {
+		rec[31] |= offsets.TableAbsent
+	}
+	enc.intervals.Write(rec)
+	return nil
+}
+
+// string returns the reference of a string, appending it to the strings section if it is not there yet
+func (enc *tableEncoder) string(s string) (uint32, error) {
+	if ref, ok := enc.refs[s]; ok {
+		return ref, nil
+	}
+	if len(s) > math.MaxUint16 {
+		return 0, fmt.Errorf("string too long: %q", s[:32])
+	}
+	ref := uint32(enc.strings.Len())
+	enc.strings.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(s))))
+	enc.strings.WriteString(s)
+	enc.refs[s] = ref
+	return ref, nil
+}
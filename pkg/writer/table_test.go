@@ -0,0 +1,132 @@
+package writer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+)
+
+const tableTrack = `{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"offsets": [
+					{ "offset": 0, "since": "1.12.0", "size": 16 },
+					{ "offset": 0, "since": "1.12.0", "arch": "386", "size": 8 },
+					{ "offset": 8, "since": "1.21.0-rc.2", "size": 16 },
+					{ "offset": 16, "since": "1.21.0", "size": 16 }
+				]
+			},
+			"Pattern": {
+				"versions": { "oldest": "1.12.0", "newest": "1.21.0" },
+				"offsets": [
+					{ "since": "1.12.0", "absent": true },
+					{ "offset": 240, "since": "1.21.0-rc.2", "size": 16 }
+				]
+			}
+		},
+		"google.golang.org/grpc/internal/transport.Stream": {
+			"method": {
+				"versions": { "oldest": "1.3.0", "newest": "1.60.0" },
+				"offsets": [
+					{ "offset": 80, "since": "1.3.0" },
+					{ "offset": 64, "since": "1.15.0" }
+				]
+			}
+		}
+	},
+	"structs": {
+		"net/http.Request": {
+			"sizes": [
+				{ "size": 248, "since": "1.12.0" },
+				{ "size": 132, "since": "1.12.0", "arch": "386" },
+				{ "size": 252, "since": "1.20.9" },
+				{ "size": 256, "since": "1.21.0-rc.2" }
+			]
+		}
+	}
+}`
+
+func TestEncodeTable_RoundTrip(t *testing.T) {
+	for name, open := range map[string]func() (*offsets.Track, error){
+		"synthetic": func() (*offsets.Track, error) { return offsets.Read(bytes.NewBufferString(tableTrack)) },
+		"examples":  func() (*offsets.Track, error) { return offsets.Open("../../examples/offsets.json") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			track, err := open()
+			require.NoError(t, err)
+			data, err := EncodeTable(track)
+			require.NoError(t, err)
+			table, err := offsets.ReadTable(data)
+			require.NoError(t, err)
+
+			vers := []string{"0.0.1", "1.2.0", "1.12.0", "1.15.0", "1.20.9", "1.21.0-rc.1", "1.21.0-rc.2",
+				"1.21.0-rc.10", "1.21.0", "v1.21.3", "1.60.0"}
+			for structName, strct := range track.Data {
+				for fieldName, field := range strct {
+					for _, od := range field.Offsets {
+						vers = append(vers, od.Since)
+					}
+					for _, arch := range []string{"", "amd64", "386", "arm64"} {
+						for _, v := range vers {
+							expected, expectedPresence := track.FindPresence(arch, structName, fieldName, v)
+							actual, presence := table.FindPresence(arch, structName, fieldName, v)
+							assert.Equalf(t, expectedPresence, presence, "%s %s %s %s", structName, fieldName, arch, v)
+							assert.Equalf(t, expected, actual, "%s %s %s %s", structName, fieldName, arch, v)
+
+							expected, expectedOK := track.StructSize(arch, structName, v)
+							actual, ok := table.StructSize(arch, structName, v)
+							assert.Equalf(t, expectedOK, ok, "%s %s %s", structName, arch, v)
+							assert.Equalf(t, expected, actual, "%s %s %s", structName, arch, v)
+						}
+					}
+				}
+			}
+			_, ok := table.Find("net/http.Request", "Unknown", "1.21.0")
+			assert.False(t, ok)
+			_, ok = table.Find("net/http.Unknown", "Method", "1.21.0")
+			assert.False(t, ok)
+			_, ok = table.Find("net/http.Request", "Method", "invalid")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestEncodeTable_ZeroAllocations(t *testing.T) {
+	track, err := offsets.Read(bytes.NewBufferString(tableTrack))
+	require.NoError(t, err)
+	data, err := EncodeTable(track)
+	require.NoError(t, err)
+	table, err := offsets.ReadTable(data)
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		table.Find("net/http.Request", "Method", "1.21.0-rc.3")
+		table.FindPresence("386", "net/http.Request", "Pattern", "v1.20.1")
+		table.StructSize("", "net/http.Request", "1.21.0")
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestReadTable_Invalid(t *testing.T) {
+	track, err := offsets.Read(bytes.NewBufferString(tableTrack))
+	require.NoError(t, err)
+	data, err := EncodeTable(track)
+	require.NoError(t, err)
+
+	_, err = offsets.ReadTable([]byte("{}"))
+	assert.Error(t, err)
+	_, err = offsets.ReadTable(data[:len(data)-1])
+	assert.Error(t, err)
+	// string reference of the first field out of bounds
+	corrupted := append([]byte{}, data...)
+	corrupted[offsets.TableHeaderSize] = 0xff
+	corrupted[offsets.TableHeaderSize+1] = 0xff
+	_, err = offsets.ReadTable(corrupted)
+	assert.Error(t, err)
+}
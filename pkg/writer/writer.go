@@ -3,6 +3,7 @@ package writer
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -13,16 +14,42 @@ import (
 
 	"github.com/grafana/go-offsets-tracker/pkg/versions"
 
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
 	"github.com/grafana/go-offsets-tracker/pkg/offsets"
 	"github.com/grafana/go-offsets-tracker/pkg/target"
 )
 
-func WriteResults(fileName string, results ...*target.Result) error {
+// Mode of writing the results when the output file already exists
+type Mode int
+
+const (
+	// MergeMode updates the fields of the existing output file that are part of the results,
+	// and keeps the rest of the existing fields and structs as they are
+	MergeMode Mode = 0
+	// PruneMode updates the existing output file as MergeMode does, and then removes the structs and
+	// fields that are not in the input file. If the existing output file can't be read, it is overwritten
+	PruneMode Mode = 1
+)
+
+// WriteResults writes the results into the output file, according to the Mode. The input file libraries
+// are only used by PruneMode, so the structs and fields of the libraries that failed are kept
+func WriteResults(fileName string, mode Mode, input offsets.InputLibs, results ...*target.Result) error {
 	offsets := offsets.Track{
 		Data: map[string]offsets.Struct{},
 	}
 	for _, r := range results {
-		convertResult(r, &offsets)
+		if r != nil {
+			convertResult(r, &offsets)
+		}
+	}
+
+	existing, err := readExisting(fileName)
+	if err != nil && mode == MergeMode {
+		return err
+	}
+	offsets = *merge(existing, &offsets)
+	if mode == PruneMode {
+		prune(&offsets, input)
 	}
 
 	jsonData, err := json.Marshal(&offsets)
@@ -39,17 +66,131 @@ func WriteResults(fileName string, results ...*target.Result) error {
 	return os.WriteFile(fileName, prettyJson.Bytes(), fs.ModePerm)
 }
 
+// readExisting reads the existing output file, or returns nil if it does not exist
+func readExisting(fileName string) (*offsets.Track, error) {
+	existing, err := offsets.Open(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't merge the results with the existing %s file. Remove it or prune it: %w", fileName, err)
+	}
+	return existing, nil
+}
+
+// prune removes the structs and fields that are not tracked by the input file libraries, and the
+// modules that do not own any of the remaining structs
+func prune(track *offsets.Track, input offsets.InputLibs) {
+	tracked := input.TrackedFields()
+	for structName, strct := range track.Data {
+		for fieldName := range strct {
+			if !tracked[structName][fieldName] {
+				delete(strct, fieldName)
+			}
+		}
+		if len(strct) == 0 {
+			delete(track.Data, structName)
+			delete(track.Structs, structName)
+		}
+	}
+	modules := make([]string, 0, len(track.Modules))
+	for module := range track.Modules {
+		modules = append(modules, module)
+	}
+	owners := map[string]bool{}
+	for structName := range track.Data {
+		owners[offsets.ModuleOf(offsets.StructPackage(structName), modules)] = true
+	}
+	for module := range track.Modules {
+		if !owners[module] {
+			delete(track.Modules, module)
+		}
+	}
+}
+
+// merge replaces the offsets and struct sizes of the existing track with the results, only for the
+// architectures and versions ranges of the results. The rest of offsets, sizes, fields and structs
+// of the existing track are kept, as well as the versions of the modules that were previously seen
+func merge(existing, results *offsets.Track) *offsets.Track {
+	if existing == nil {
+		return results
+	}
+	if existing.Data == nil {
+		existing.Data = map[string]offsets.Struct{}
+	}
+	for structName, fields := range results.Data {
+		strct, ok := existing.Data[structName]
+		if !ok {
+			strct = offsets.Struct{}
+			existing.Data[structName] = strct
+		}
+		for fieldName, field := range fields {
+			if old, ok := strct[fieldName]; ok {
+				field = mergeField(&old, &field)
+			}
+			strct[fieldName] = field
+		}
+	}
+	for structName, info := range results.Structs {
+		if existing.Structs == nil {
+			existing.Structs = map[string]offsets.StructInfo{}
+		}
+		// the sizes of the results cover the versions ranges of the analyzed fields of the struct
+		ranges := map[string]offsets.VersionInfo{}
+		for _, field := range results.Data[structName] {
+			for arch, vi := range archVersions(&field) {
+				ranges[arch] = unionVersions(ranges[arch], vi)
+			}
+		}
+		info.Sizes = mergeSizes(existing.Structs[structName].Sizes, info.Sizes, ranges)
+		existing.Structs[structName] = info
+	}
+	for module, mod := range results.Modules {
+		for libVersion, modVersion := range mod.Seen {
+			recordSeen(existing, module, libVersion, modVersion)
+		}
+	}
+	return existing
+}
+
 func convertResult(r *target.Result, track *offsets.Track) {
 	offsetsMap := make(map[string][]offsets.Versioned)
+	// sizesMap key: struct name and architecture. Value: struct sizes found in each version
+	sizesMap := make(map[string][]offsets.VersionedSize)
 	for _, vr := range r.ResultsByVersion {
 		for _, od := range vr.OffsetData.DataMembers {
-			key := fmt.Sprintf("%s,%s", od.StructName, od.Field)
+			// the offsets of structs from other modules refer to the versions of these modules
+			since := versions.OrZero(vr.Version).String()
+			if od.Module != "" {
+				since = od.ModuleVersion
+				recordSeen(track, od.Module, offsets.SeenKey(r.ModuleName, vr.Version), od.ModuleVersion)
+			}
+			// offsets are normalized independently for each architecture
+			arch := offsets.ArchOrDefault(vr.Arch)
+			key := fmt.Sprintf("%s,%s,%s", od.StructName, od.Field, arch)
+			if arch == offsets.DefaultArch {
+				// keep compatibility with the files generated before the architectures were tracked
+				arch = ""
+			}
+			if od.Absent {
+				offsetsMap[key] = append(offsetsMap[key], offsets.Versioned{Since: since, Arch: arch, Absent: true})
+				continue
+			}
 			offsetsMap[key] = append(offsetsMap[key], offsets.Versioned{
 				Offset: od.Offset,
-				Since:  versions.OrZero(vr.Version).String(),
+				Since:  since,
+				Arch:   arch,
+				Path:   pathHops(od.Hops),
+				Size:   od.Size,
+				Type:   od.Type,
 			})
+			if od.StructSize > 0 {
+				sizeKey := od.StructName + "," + offsets.ArchOrDefault(arch)
+				sizesMap[sizeKey] = append(sizesMap[sizeKey], offsets.VersionedSize{Size: od.StructSize, Since: since, Arch: arch})
+			}
 		}
 	}
+	convertSizes(sizesMap, track)
 
 	// normalize offsets: just annotate the offsets from the version
 	// that changed them
@@ -70,7 +211,7 @@ func convertResult(r *target.Result, track *offsets.Track) {
 		for n, off := range offs {
 			hilo.updateModuleVersion(off.Since)
 			// only append versions that changed the field value from its predecessor
-			if n == 0 || off.Offset != last.Offset {
+			if n == 0 || !sameValue(&off, &last) {
 				om = append(om, off)
 			}
 			last = off
@@ -79,23 +220,213 @@ func convertResult(r *target.Result, track *offsets.Track) {
 		fieldVersionsMap[key] = hilo
 	}
 
-	// Append offsets as fields to the existing file map map
-	for key, offs := range offsetsMap {
+	// Append offsets as fields to the existing file map map. The offsets of all the
+	// architectures are merged into the same field, keeping the versions range of each one
+	for _, key := range sortedKeys(offsetsMap) {
+		offs := offsetsMap[key]
 		parts := strings.Split(key, ",")
 		strFields, ok := track.Data[parts[0]]
 		if !ok {
 			strFields = offsets.Struct{}
 			track.Data[parts[0]] = strFields
 		}
+		field := strFields[parts[1]]
+		archRanges := archVersions(&field)
 		hl := fieldVersionsMap[key]
-		strFields[parts[1]] = offsets.Field{
-			Offsets: offs,
-			Versions: offsets.VersionInfo{
-				Oldest: hl.lo.String(),
-				Newest: hl.hi.String(),
-			},
+		if vi, ok := archRanges[parts[2]]; ok {
+			hl.updateModuleVersion(vi.Oldest)
+			hl.updateModuleVersion(vi.Newest)
+		}
+		archRanges[parts[2]] = offsets.VersionInfo{
+			Oldest: hl.lo.String(),
+			Newest: hl.hi.String(),
+		}
+		field.Offsets = append(field.Offsets, offs...)
+		field.Versions, field.ArchVersions = mergeVersions(archRanges), nil
+		if len(archRanges) > 1 {
+			field.ArchVersions = archRanges
+		}
+		strFields[parts[1]] = field
+	}
+}
+
+// archVersions returns the versions range of each architecture whose offsets are in the field
+func archVersions(field *offsets.Field) map[string]offsets.VersionInfo {
+	ranges := map[string]offsets.VersionInfo{}
+	for _, od := range field.Offsets {
+		arch := offsets.ArchOrDefault(od.Arch)
+		if vi, ok := field.VersionsArch(arch); ok && vi.Oldest != "" {
+			ranges[arch] = vi
+		}
+	}
+	return ranges
+}
+
+// mergeVersions returns the versions range that covers the ranges of all the architectures
+func mergeVersions(ranges map[string]offsets.VersionInfo) offsets.VersionInfo {
+	hl := hiLoSemVers{}
+	for _, vi := range ranges {
+		hl.updateModuleVersion(vi.Oldest)
+		hl.updateModuleVersion(vi.Newest)
+	}
+	return offsets.VersionInfo{Oldest: hl.lo.String(), Newest: hl.hi.String()}
+}
+
+// unionVersions returns the versions range that covers both ranges. Empty ranges are ignored
+func unionVersions(a, b offsets.VersionInfo) offsets.VersionInfo {
+	if a.Oldest == "" {
+		return b
+	}
+	if b.Oldest == "" {
+		return a
+	}
+	return mergeVersions(map[string]offsets.VersionInfo{"a": a, "b": b})
+}
+
+// mergeField replaces the offsets of the old field that are in the architectures and versions
+// ranges of the result field. The versions after the range of the result keep their old offsets
+// from the next version where they changed
+func mergeField(old, result *offsets.Field) offsets.Field {
+	ranges, resultRanges := archVersions(old), archVersions(result)
+	var offs []offsets.Versioned
+	for _, od := range old.Offsets {
+		if vi, ok := resultRanges[offsets.ArchOrDefault(od.Arch)]; !ok || !inRange(od.Since, vi) {
+			offs = append(offs, od)
+		}
+	}
+	offs = append(offs, result.Offsets...)
+	sort.SliceStable(offs, func(i, j int) bool {
+		return lessArchVersion(offs[i].Arch, offs[i].Since, offs[j].Arch, offs[j].Since)
+	})
+	merged := offsets.Field{}
+	for n := range offs {
+		// only keep the entries that changed the field value from its predecessor in the same architecture
+		if n == 0 || offsets.ArchOrDefault(offs[n].Arch) != offsets.ArchOrDefault(offs[n-1].Arch) ||
+			!sameValue(&offs[n], &offs[n-1]) {
+			merged.Offsets = append(merged.Offsets, offs[n])
+		}
+	}
+	for arch, vi := range resultRanges {
+		ranges[arch] = unionVersions(ranges[arch], vi)
+	}
+	merged.Versions = mergeVersions(ranges)
+	if len(ranges) > 1 {
+		merged.ArchVersions = ranges
+	}
+	return merged
+}
+
+// mergeSizes replaces the old struct sizes that are in the architectures and versions ranges
+// of the results, as mergeField does with the offsets
+func mergeSizes(old, results []offsets.VersionedSize, ranges map[string]offsets.VersionInfo) []offsets.VersionedSize {
+	var sizes []offsets.VersionedSize
+	for _, size := range old {
+		if vi, ok := ranges[offsets.ArchOrDefault(size.Arch)]; !ok || !inRange(size.Since, vi) {
+			sizes = append(sizes, size)
+		}
+	}
+	sizes = append(sizes, results...)
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return lessArchVersion(sizes[i].Arch, sizes[i].Since, sizes[j].Arch, sizes[j].Since)
+	})
+	var merged []offsets.VersionedSize
+	for n, size := range sizes {
+		if n == 0 || offsets.ArchOrDefault(size.Arch) != offsets.ArchOrDefault(sizes[n-1].Arch) ||
+			size.Size != sizes[n-1].Size {
+			merged = append(merged, size)
+		}
+	}
+	return merged
+}
+
+// inRange returns whether the version is within the versions range, both ends included
+func inRange(ver string, vi offsets.VersionInfo) bool {
+	v := versions.OrZero(ver)
+	return !v.LessThan(versions.OrZero(vi.Oldest)) && !v.GreaterThan(versions.OrZero(vi.Newest))
+}
+
+// lessArchVersion sorts the entries by architecture, and then from older to newer version
+func lessArchVersion(archA, sinceA, archB, sinceB string) bool {
+	if archA, archB = offsets.ArchOrDefault(archA), offsets.ArchOrDefault(archB); archA != archB {
+		return archA < archB
+	}
+	return versions.OrZero(sinceA).LessThan(versions.OrZero(sinceB))
+}
+
+// convertSizes appends the struct sizes to the track, only annotating the versions that changed them
+func convertSizes(sizesMap map[string][]offsets.VersionedSize, track *offsets.Track) {
+	keys := make([]string, 0, len(sizesMap))
+	for k := range sizesMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sizes := sizesMap[key]
+		sort.SliceStable(sizes, func(i, j int) bool {
+			return versions.MustParse(sizes[i].Since).LessThan(versions.MustParse(sizes[j].Since))
+		})
+		structName := key[:strings.LastIndexByte(key, ',')]
+		if track.Structs == nil {
+			track.Structs = map[string]offsets.StructInfo{}
+		}
+		info := track.Structs[structName]
+		for n, size := range sizes {
+			if n == 0 || size.Size != sizes[n-1].Size {
+				info.Sizes = append(info.Sizes, size)
+			}
+		}
+		track.Structs[structName] = info
+	}
+}
+
+// recordSeen records the version of a dependency module that was linked into a library version
+func recordSeen(track *offsets.Track, module, libVersion, modVersion string) {
+	if track.Modules == nil {
+		track.Modules = map[string]offsets.Module{}
+	}
+	mod := track.Modules[module]
+	if mod.Seen == nil {
+		mod.Seen = map[string]string{}
+		track.Modules[module] = mod
+	}
+	mod.Seen[libVersion] = modVersion
+}
+
+// sortedKeys returns the keys of the offsets map sorted alphabetically, so the offsets
+// of different architectures are appended in a deterministic order
+func sortedKeys(offsetsMap map[string][]offsets.Versioned) []string {
+	keys := make([]string, 0, len(offsetsMap))
+	for k := range offsetsMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func pathHops(hops []binary.Hop) []offsets.Hop {
+	if len(hops) == 0 {
+		return nil
+	}
+	path := make([]offsets.Hop, 0, len(hops))
+	for _, h := range hops {
+		path = append(path, offsets.Hop{Field: h.Field, Offset: h.Offset, Deref: h.Deref})
+	}
+	return path
+}
+
+// sameValue returns whether both versioned entries locate the field at the same place,
+// with the same type and size, or both are absent
+func sameValue(a, b *offsets.Versioned) bool {
+	if a.Absent != b.Absent || a.Offset != b.Offset || a.Size != b.Size || a.Type != b.Type ||
+		len(a.Path) != len(b.Path) {
+		return false
+	}
+	for i := range a.Path {
+		if a.Path[i] != b.Path[i] {
+			return false
 		}
 	}
+	return true
 }
 
 // hiLoSemVers track highest and lowest version
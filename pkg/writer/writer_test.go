@@ -0,0 +1,359 @@
+package writer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/go-offsets-tracker/pkg/binary"
+	"github.com/grafana/go-offsets-tracker/pkg/offsets"
+	"github.com/grafana/go-offsets-tracker/pkg/target"
+)
+
+const existingFile = `{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.12.0" },
+				"offsets": [ { "offset": 100, "since": "1.12.0" } ]
+			},
+			"Removed": {
+				"versions": { "oldest": "1.12.0", "newest": "1.12.0" },
+				"offsets": [ { "offset": 200, "since": "1.12.0" } ]
+			}
+		},
+		"github.com/failed/lib.Struct": {
+			"field": {
+				"versions": { "oldest": "1.0.0", "newest": "1.0.0" },
+				"offsets": [ { "offset": 300, "since": "1.0.0" } ]
+			}
+		}
+	}
+}`
+
+func goResult() *target.Result {
+	return &target.Result{
+		ModuleName: offsets.GoStdLib,
+		ResultsByVersion: []*target.VersionedResult{{
+			Version: "1.20.0",
+			OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{{
+				DataMember: &binary.DataMember{StructName: "net/http.Request", Field: "Method"},
+				Offset:     8,
+				Type:       "string",
+			}}},
+		}},
+	}
+}
+
+func TestWriteResults_Merge(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte(existingFile), 0o644))
+
+	require.NoError(t, WriteResults(file, MergeMode, nil, goResult()))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	// the offsets of the results are added to the fields, keeping the versions out of their range
+	off, ok := track.Find("net/http.Request", "Method", "1.20.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 8, off)
+	off, ok = track.Find("net/http.Request", "Method", "1.12.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 100, off)
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.12.0", Newest: "1.20.0"}, track.Data["net/http.Request"]["Method"].Versions)
+	// fields of a single architecture do not repeat their versions range
+	assert.Nil(t, track.Data["net/http.Request"]["Method"].ArchVersions)
+	// the rest are kept
+	off, ok = track.Find("net/http.Request", "Removed", "1.12.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 200, off)
+	off, ok = track.Find("github.com/failed/lib.Struct", "field", "1.0.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 300, off)
+}
+
+func TestWriteResults_Prune(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte(existingFile), 0o644))
+
+	input := offsets.InputLibs{
+		offsets.GoStdLib: offsets.LibQuery{Fields: map[string][]string{"net/http.Request": {"Method"}}},
+		// the library failed, so there are no results for it
+		"github.com/failed/lib": offsets.LibQuery{Fields: map[string][]string{"github.com/failed/lib.Struct": {"[1.0.0,]field"}}},
+	}
+	require.NoError(t, WriteResults(file, PruneMode, input, goResult()))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Method"}, fieldNames(track.Data["net/http.Request"]))
+	// the fields of the input file are kept, even if they are not in the results
+	off, ok := track.Find("github.com/failed/lib.Struct", "field", "1.0.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 300, off)
+
+	// structs that are no longer in the input file are removed
+	delete(input, offsets.GoStdLib)
+	require.NoError(t, WriteResults(file, PruneMode, input, goResult()))
+	track, err = offsets.Open(file)
+	require.NoError(t, err)
+	assert.NotContains(t, track.Data, "net/http.Request")
+	assert.Contains(t, track.Data, "github.com/failed/lib.Struct")
+}
+
+func TestWriteResults_MergeInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte("not json"), 0o644))
+
+	assert.Error(t, WriteResults(file, MergeMode, nil, goResult()))
+	require.NoError(t, WriteResults(file, PruneMode, nil, goResult()))
+	_, err := offsets.Open(file)
+	assert.NoError(t, err)
+}
+
+func TestWriteResults_Absent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	dm := &binary.DataMember{StructName: "net/http.Request", Field: "Pattern", Optional: true}
+	result := &target.Result{ModuleName: offsets.GoStdLib}
+	for _, vr := range []struct {
+		version string
+		absent  bool
+	}{{"1.21.0", true}, {"1.21.1", true}, {"1.22.0", false}, {"1.23.0", false}} {
+		dmo := &binary.DataMemberOffset{DataMember: dm, Absent: true}
+		if !vr.absent {
+			dmo = &binary.DataMemberOffset{DataMember: dm, Offset: 240, Type: "string"}
+		}
+		result.ResultsByVersion = append(result.ResultsByVersion, &target.VersionedResult{
+			Version: vr.version, OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{dmo}},
+		})
+	}
+	require.NoError(t, WriteResults(file, MergeMode, nil, result))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	// consecutive absent versions are normalized into a single entry
+	assert.Equal(t, []offsets.Versioned{
+		{Since: "1.21.0", Absent: true},
+		{Offset: 240, Since: "1.22.0", Type: "string"},
+	}, track.Data["net/http.Request"]["Pattern"].Offsets)
+	_, presence := track.FindPresence(offsets.DefaultArch, "net/http.Request", "Pattern", "1.21.1")
+	assert.Equal(t, offsets.Absent, presence)
+	off, presence := track.FindPresence(offsets.DefaultArch, "net/http.Request", "Pattern", "1.23.0")
+	assert.Equal(t, offsets.Present, presence)
+	assert.EqualValues(t, 240, off)
+}
+
+func TestWriteResults_StructSizes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	method := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	url := &binary.DataMember{StructName: "net/http.Request", Field: "URL"}
+	result := &target.Result{ModuleName: offsets.GoStdLib}
+	for _, vr := range []struct {
+		version, arch string
+		size          uint64
+	}{{"1.12.0", "", 248}, {"1.13.0", "", 252}, {"1.14.0", "", 252}, {"1.12.0", "386", 132}} {
+		result.ResultsByVersion = append(result.ResultsByVersion, &target.VersionedResult{
+			Version: vr.version, Arch: vr.arch, OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{
+				{DataMember: method, Offset: 0, Type: "string", StructSize: vr.size},
+				{DataMember: url, Offset: 16, Type: "*net/url.URL", StructSize: vr.size},
+			}},
+		})
+	}
+	require.NoError(t, WriteResults(file, MergeMode, nil, result))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	// the struct size changes are recorded once per struct, without adding entries to the fields
+	assert.Equal(t, map[string]offsets.StructInfo{"net/http.Request": {Sizes: []offsets.VersionedSize{
+		{Size: 132, Since: "1.12.0", Arch: "386"}, {Size: 248, Since: "1.12.0"}, {Size: 252, Since: "1.13.0"},
+	}}}, track.Structs)
+	assert.Len(t, track.Data["net/http.Request"]["Method"].Offsets, 2)
+	assert.Len(t, track.Data["net/http.Request"]["URL"].Offsets, 2)
+	size, ok := track.StructSize("", "net/http.Request", "1.14.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 252, size)
+	size, ok = track.StructSize("386", "net/http.Request", "1.14.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 132, size)
+	_, ok = track.StructSize("", "net/http.Request", "1.11.0")
+	assert.False(t, ok)
+}
+
+func TestWriteResults_ArchVersions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	dm := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	result := &target.Result{ModuleName: offsets.GoStdLib}
+	// arm64 was analyzed for a shorter versions range than amd64
+	for _, vr := range []struct{ version, arch string }{
+		{"1.12.0", "amd64"}, {"1.20.0", "amd64"}, {"1.18.0", "arm64"}, {"1.20.0", "arm64"},
+	} {
+		result.ResultsByVersion = append(result.ResultsByVersion, &target.VersionedResult{
+			Version: vr.version, Arch: vr.arch, OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{
+				{DataMember: dm, Offset: 0, Type: "string"},
+			}},
+		})
+	}
+	require.NoError(t, WriteResults(file, MergeMode, nil, result))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	field := track.Data["net/http.Request"]["Method"]
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.12.0", Newest: "1.20.0"}, field.Versions)
+	vi, ok := field.VersionsArch("arm64")
+	assert.True(t, ok)
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.18.0", Newest: "1.20.0"}, vi)
+	vi, ok = field.VersionsArch("")
+	assert.True(t, ok)
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.12.0", Newest: "1.20.0"}, vi)
+	_, ok = field.VersionsArch("386")
+	assert.False(t, ok)
+
+	// the results of an architecture keep the offsets and versions range of the rest of architectures
+	require.NoError(t, WriteResults(file, MergeMode, nil, goResult()))
+	track, err = offsets.Open(file)
+	require.NoError(t, err)
+	field = track.Data["net/http.Request"]["Method"]
+	vi, ok = field.VersionsArch("arm64")
+	assert.True(t, ok)
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.18.0", Newest: "1.20.0"}, vi)
+	off, ok := track.FindArch("arm64", "net/http.Request", "Method", "1.20.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 0, off)
+	off, ok = track.FindArch("amd64", "net/http.Request", "Method", "1.20.0")
+	assert.True(t, ok)
+	assert.EqualValues(t, 8, off)
+}
+
+func TestWriteResults_MergeRanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+	"data": {
+		"net/http.Request": {
+			"Method": {
+				"versions": { "oldest": "1.12.0", "newest": "1.22.0" },
+				"arch_versions": {
+					"amd64": { "oldest": "1.12.0", "newest": "1.22.0" },
+					"arm64": { "oldest": "1.16.0", "newest": "1.22.0" }
+				},
+				"offsets": [
+					{ "offset": 0, "since": "1.12.0" },
+					{ "offset": 8, "since": "1.16.0" },
+					{ "offset": 16, "since": "1.22.0" },
+					{ "offset": 0, "since": "1.16.0", "arch": "arm64" }
+				]
+			}
+		}
+	},
+	"structs": {
+		"net/http.Request": {
+			"sizes": [
+				{ "size": 240, "since": "1.12.0" },
+				{ "size": 248, "since": "1.16.0" },
+				{ "size": 256, "since": "1.22.0" },
+				{ "size": 240, "since": "1.16.0", "arch": "arm64" }
+			]
+		}
+	}
+}`), 0o644))
+
+	// versions 1.16.0 to 1.20.0 are analyzed again for amd64
+	dm := &binary.DataMember{StructName: "net/http.Request", Field: "Method"}
+	result := &target.Result{ModuleName: offsets.GoStdLib}
+	for _, v := range []string{"1.16.0", "1.18.0", "1.20.0"} {
+		result.ResultsByVersion = append(result.ResultsByVersion, &target.VersionedResult{
+			Version: v, OffsetData: &binary.Result{DataMembers: []*binary.DataMemberOffset{
+				{DataMember: dm, Offset: 4, Type: "string", StructSize: 244},
+			}},
+		})
+	}
+	require.NoError(t, WriteResults(file, MergeMode, nil, result))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	field := track.Data["net/http.Request"]["Method"]
+	assert.Equal(t, []offsets.Versioned{
+		{Offset: 0, Since: "1.12.0"},
+		{Offset: 4, Since: "1.16.0", Type: "string"},
+		{Offset: 16, Since: "1.22.0"},
+		{Offset: 0, Since: "1.16.0", Arch: "arm64"},
+	}, sortedOffsets(field.Offsets))
+	assert.Equal(t, offsets.VersionInfo{Oldest: "1.12.0", Newest: "1.22.0"}, field.Versions)
+	assert.Equal(t, map[string]offsets.VersionInfo{
+		"amd64": {Oldest: "1.12.0", Newest: "1.22.0"},
+		"arm64": {Oldest: "1.16.0", Newest: "1.22.0"},
+	}, field.ArchVersions)
+	assert.Equal(t, []offsets.VersionedSize{
+		{Size: 240, Since: "1.12.0"},
+		{Size: 244, Since: "1.16.0"},
+		{Size: 256, Since: "1.22.0"},
+		{Size: 240, Since: "1.16.0", Arch: "arm64"},
+	}, sortedSizes(track.Structs["net/http.Request"].Sizes))
+}
+
+func TestWriteResults_PruneModules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "offsets.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+	"data": {
+		"golang.org/x/net/http2.FrameHeader": {
+			"Type": { "versions": { "oldest": "0.10.0", "newest": "0.10.0" }, "offsets": [ { "offset": 1, "since": "0.10.0" } ] }
+		},
+		"golang.org/x/net/http2/hpack.HeaderField": {
+			"Name": { "versions": { "oldest": "0.10.0", "newest": "0.10.0" }, "offsets": [ { "offset": 0, "since": "0.10.0" } ] }
+		},
+		"google.golang.org/protobuf/proto.MarshalOptions": {
+			"Deterministic": { "versions": { "oldest": "1.30.0", "newest": "1.30.0" }, "offsets": [ { "offset": 1, "since": "1.30.0" } ] }
+		}
+	},
+	"modules": {
+		"golang.org/x/net": { "seen": { "google.golang.org/grpc@1.54.0": "0.10.0" } },
+		"google.golang.org/protobuf": { "seen": { "google.golang.org/grpc@1.54.0": "1.30.0" } }
+	}
+}`), 0o644))
+
+	input := offsets.InputLibs{"google.golang.org/grpc": offsets.LibQuery{Fields: map[string][]string{
+		"golang.org/x/net/http2/hpack.HeaderField": {"Name"},
+	}}}
+	require.NoError(t, WriteResults(file, PruneMode, input))
+
+	track, err := offsets.Open(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"golang.org/x/net/http2/hpack.HeaderField"}, structNames(track))
+	// the modules that do not own any remaining struct are removed
+	assert.Equal(t, map[string]offsets.Module{
+		"golang.org/x/net": {Seen: map[string]string{"google.golang.org/grpc@1.54.0": "0.10.0"}},
+	}, track.Modules)
+}
+
+// sortedOffsets returns the offsets sorted by architecture, and then by version, as they are merged
+func sortedOffsets(offs []offsets.Versioned) []offsets.Versioned {
+	sort.SliceStable(offs, func(i, j int) bool {
+		return lessArchVersion(offs[i].Arch, offs[i].Since, offs[j].Arch, offs[j].Since)
+	})
+	return offs
+}
+
+func sortedSizes(sizes []offsets.VersionedSize) []offsets.VersionedSize {
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return lessArchVersion(sizes[i].Arch, sizes[i].Since, sizes[j].Arch, sizes[j].Since)
+	})
+	return sizes
+}
+
+func structNames(track *offsets.Track) []string {
+	var names []string
+	for name := range track.Data {
+		names = append(names, name)
+	}
+	return names
+}
+
+func fieldNames(s offsets.Struct) []string {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	return names
+}